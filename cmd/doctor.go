@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/thylong/ian/pkg/doctor"
+)
+
+var doctorFix bool
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Fix the problems that can be fixed safely")
+
+	RootCmd.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the health of your environment",
+	Long: `Check the configuration, package managers, dotfiles and repositories, and
+print pass, warn or fail for each check with a hint to fix the problems.
+With --fix, the problems that can be fixed safely are fixed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		results := doctor.Run(doctorFix)
+		doctor.PrintResults(os.Stdout, results)
+		if doctor.HasFailures(results) {
+			os.Exit(1)
+		}
+	},
+}
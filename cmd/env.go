@@ -1,20 +1,71 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
 	"github.com/spf13/cobra"
+	"github.com/thylong/ian/pkg/config"
 	"github.com/thylong/ian/pkg/env"
 	"github.com/thylong/ian/pkg/log"
 	pm "github.com/thylong/ian/pkg/package-managers"
 )
 
+var envSaveForce bool
+var envSaveResume bool
+var envSaveRollback bool
+var envPullConflict string
+var envUnlinkAll bool
+var envUnlinkRemove bool
+var envUnlinkYes bool
+var envDiffOutput string
+var envDiffExitCode bool
+var envCaptureAll bool
+var envCaptureReplace bool
+var envSyncPrune bool
+var envSyncPruneOS bool
+var envSyncYes bool
+
 func init() {
+	envSaveCmd.Flags().BoolVar(&envSaveForce, "force", false, "Overwrite the remote dotfiles instead of rebasing onto them")
+	envSaveCmd.Flags().BoolVar(&envSaveResume, "resume", false, "Complete the interrupted save")
+	envSaveCmd.Flags().BoolVar(&envSaveRollback, "rollback", false, "Restore the dotfiles moved by the interrupted save")
+	envPullCmd.Flags().StringVar(&envPullConflict, "conflict", "", "What to do with existing dotfiles: skip, backup, overwrite or prompt (default dotfiles.conflict or backup)")
+	envUnlinkCmd.Flags().BoolVar(&envUnlinkAll, "all", false, "Unlink every dotfile")
+	envUnlinkCmd.Flags().BoolVar(&envUnlinkRemove, "remove", false, "Remove the dotfiles from the dotfiles directory")
+	envUnlinkCmd.Flags().BoolVarP(&envUnlinkYes, "yes", "y", false, "Unlink every dotfile without asking for confirmation")
+	envDiffCmd.Flags().StringVarP(&envDiffOutput, "output", "o", "text", "Output format of the diff (text or json)")
+	envDiffCmd.Flags().BoolVar(&envDiffExitCode, "exit-code", false, "Exit with 1 if installed packages don't match env.yml")
+	envCaptureCmd.Flags().BoolVar(&envCaptureAll, "all", false, "Add every captured package without asking")
+	envCaptureCmd.Flags().BoolVar(&envCaptureReplace, "replace", false, "Replace the packages of env.yml instead of merging")
+	envSyncCmd.Flags().BoolVar(&envSyncPrune, "prune", false, "Uninstall the packages installed on purpose but not declared in env.yml")
+	envSyncCmd.Flags().BoolVar(&envSyncPruneOS, "prune-os", false, "Prune the packages of apt and yum too, base system packages included")
+	envSyncCmd.Flags().BoolVarP(&envSyncYes, "yes", "y", false, "Apply the plan without asking for confirmation")
+
 	RootCmd.AddCommand(
 		envAddCmd,
 		envRemoveCmd,
 		envSaveCmd,
+		envPullCmd,
+		envUnlinkCmd,
+		envCmd,
+	)
+	envCmd.AddCommand(
+		envDiffCmd,
+		envCaptureCmd,
+		envSyncCmd,
 	)
 }
 
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage development environment",
+	Long:  `Manage the packages of your development environment declared in env.yml.`,
+}
+
 var envAddCmd = &cobra.Command{
 	Use:   "add",
 	Short: "Add new package(s) to ian configuration",
@@ -34,7 +85,10 @@ var envAddCmd = &cobra.Command{
 			return
 		}
 
-		env.AddPackagesToEnvFile(packageManagerName, packages)
+		if err := env.AddPackagesToEnvFile(packageManagerName, packages); err != nil {
+			log.Errorln(err)
+			return
+		}
 		log.Infof("Package(s) added to %s list\n", packageManagerName)
 	},
 }
@@ -58,18 +112,221 @@ var envRemoveCmd = &cobra.Command{
 			return
 		}
 
-		env.RemovePackagesFromEnvFile(packageManagerName, packages)
+		if err := env.RemovePackagesFromEnvFile(packageManagerName, packages); err != nil {
+			log.Errorln(err)
+			return
+		}
 		log.Infof("Package(s) removed to %s list\n", args[0])
 	},
 }
 
 var envSaveCmd = &cobra.Command{
-	Use:   "save",
+	Use:   "save [paths...]",
 	Short: "Save current configuration files to the dotfiles repository",
-	Long:  `Save current configuration files to the dotfiles repository.`,
+	Long: `Save current configuration files to the dotfiles repository.
+
+Without paths, every dotfile of your home directory is saved, except the ones
+excluded by dotfiles.include and dotfiles.exclude from config.yml and the
+built-in excludes (caches, histories and secrets). Paths are relative to your
+home directory, can be nested (.config/nvim) and are saved unless matched by
+dotfiles.exclude.
+
+Local changes are committed and rebased onto the remote dotfiles before being
+pushed. Conflicting changes stop the save; use --force to overwrite the remote.
+
+Every step of the dotfiles import is recorded, so that a failing import is
+rolled back. If a save is interrupted, complete it with --resume or restore
+the dotfiles with --rollback.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := env.Save([]string{}); err != nil {
+		if envSaveResume && envSaveRollback {
+			log.Errorln("Save command failed: --resume and --rollback are mutually exclusive")
+			os.Exit(1)
+		}
+		if envSaveRollback {
+			if err := env.RollbackImport(); err != nil {
+				log.Errorf("Save command failed: %s\n", err)
+				os.Exit(1)
+			}
+			log.Infoln("Interrupted save rolled back.")
+			return
+		}
+		if err := env.Save(args, envSaveForce, envSaveResume); err != nil {
+			var conflictErr *env.ConflictError
+			if errors.As(err, &conflictErr) {
+				log.Errorln("Save command failed: local and remote dotfiles both changed these files:")
+				for _, file := range conflictErr.Files {
+					log.Infof("  %s\n", file)
+				}
+				log.Infoln("Resolve them with git in the dotfiles directory (git pull --rebase), or use --force to overwrite the remote.")
+				os.Exit(1)
+			}
 			log.Errorf("Save command failed: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var envPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Update dotfiles from the dotfiles repository",
+	Long: `Update dotfiles from the dotfiles repository and link the new ones into
+your home directory. Local dotfiles commits are rebased onto the remote ones.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		report, dangling, err := env.Pull(config.DotfilesDirPath, envPullConflict)
+		if err != nil {
+			var conflictErr *env.ConflictError
+			if errors.As(err, &conflictErr) {
+				log.Errorln("Pull command failed: local and remote dotfiles both changed these files:")
+				for _, file := range conflictErr.Files {
+					log.Infof("  %s\n", file)
+				}
+				log.Infoln("Resolve them with git in the dotfiles directory (git pull --rebase).")
+				os.Exit(1)
+			}
+			log.Errorf("Pull command failed: %s\n", err)
+			os.Exit(1)
+		}
+		env.PrintLinkReport(report)
+		if len(dangling) > 0 {
+			log.Warningf("These dotfiles were removed from the repository but are still linked in your home directory:\n")
+			for _, name := range dangling {
+				log.Infof("  %s\n", name)
+			}
+		}
+	},
+}
+
+var envUnlinkCmd = &cobra.Command{
+	Use:   "unlink [paths...]",
+	Short: "Replace dotfiles symlinks by regular files",
+	Long: `Replace the symlinks into the dotfiles directory found at the given paths,
+or everywhere with --all, by a copy of their target. Paths are relative to your
+home directory; directories are searched for symlinks.
+
+With --remove, the dotfiles are moved out of the dotfiles directory to stop
+tracking them; run ian save to remove them from the dotfiles repository.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if envUnlinkAll && len(args) > 0 {
+			log.Errorln("Unlink command failed: paths and --all are mutually exclusive")
+			os.Exit(1)
+		}
+		if envUnlinkAll && !envUnlinkYes {
+			in := strings.ToLower(config.GetUserInput("Unlink every dotfile? (y/N)"))
+			if in != "y" && in != "yes" {
+				log.Infoln("Aborted.")
+				return
+			}
+		}
+		unlinked, err := env.Unlink(args, envUnlinkAll, envUnlinkRemove)
+		for _, name := range unlinked {
+			log.Infof("Unlinked %s\n", name)
+		}
+		if err != nil {
+			log.Errorf("Unlink command failed: %s\n", err)
+			os.Exit(1)
+		}
+		if envUnlinkRemove && len(unlinked) > 0 {
+			log.Infoln("Run ian save to remove them from the dotfiles repository.")
+		}
+	},
+}
+
+var envDiffCmd = &cobra.Command{
+	Use:   "diff [package managers...]",
+	Short: "Compare env.yml with the installed packages",
+	Long: `Compare the packages declared in env.yml with the installed ones, for the
+given package managers or every package manager of env.yml. Packages declared
+but missing are prefixed by "-", packages installed but undeclared by "+".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if envDiffOutput != "text" && envDiffOutput != "json" {
+			exitOnError(fmt.Errorf("Unknown output format %s", envDiffOutput))
+		}
+		diffs, err := env.Diff(args)
+		exitOnError(err)
+		if envDiffOutput == "json" {
+			exitOnError(env.PrintDiffJSON(os.Stdout, diffs))
+		} else {
+			env.PrintDiff(os.Stdout, diffs)
+		}
+		if envDiffExitCode && env.HasDrift(diffs) {
+			os.Exit(1)
+		}
+	},
+}
+
+var envCaptureCmd = &cobra.Command{
+	Use:   "capture [package managers...]",
+	Short: "Add the installed packages to env.yml",
+	Long: `Query the given package managers, or every installed one, for the packages
+installed on purpose (brew leaves, casks, pip user packages, npm global
+packages, gems, apt manual packages, yum user installed packages) and add them
+to env.yml. You're asked which ones to add, unless --all is set.
+
+With --replace, the packages of the captured package managers replace the ones
+of env.yml instead of being merged into them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		captured, err := env.Capture(args, envCaptureReplace)
+		exitOnError(err)
+		if len(captured) == 0 {
+			log.Infoln("No new package to capture.")
+			return
+		}
+		if !envCaptureAll {
+			captured = env.SelectPackages(captured, config.GetUserInput)
+		}
+		if len(captured) == 0 {
+			log.Infoln("Nothing added to env.yml.")
+			return
+		}
+		exitOnError(env.SavePackagesToEnvFile(captured, envCaptureReplace))
+		var names []string
+		for name := range captured {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			log.Infof("Added %d %s packages to env.yml\n", len(captured[name]), name)
+		}
+	},
+}
+
+var envSyncCmd = &cobra.Command{
+	Use:   "sync [package managers...]",
+	Short: "Converge the installed packages to env.yml",
+	Long: `Install the packages declared in env.yml but missing, for the given package
+managers or every package manager of env.yml. With --prune, the packages
+installed on purpose but not declared are uninstalled too, except the ones of
+apt and yum: they list the base system packages as installed on purpose, so
+they're only pruned with --prune-os. Brew leaves are pruned with --prune.
+
+The plan is shown and applied once confirmed, then the outcome of every
+package is reported and the installed versions are recorded in env.lock.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		diffs, err := env.Diff(args)
+		exitOnError(err)
+		if envSyncPruneOS && !envSyncPrune {
+			exitOnError(errors.New("--prune-os requires --prune"))
+		}
+		steps := env.PlanSync(diffs, env.SyncOptions{Prune: envSyncPrune, PruneOS: envSyncPruneOS})
+		env.PrintSyncPlan(os.Stdout, diffs, steps)
+		if len(steps) == 0 {
+			log.Infoln("Installed packages match env.yml.")
+			return
+		}
+		if !envSyncYes {
+			in := strings.ToLower(config.GetUserInput(fmt.Sprintf("Apply these %d changes? (y/N)", len(steps))))
+			if in != "y" && in != "yes" {
+				log.Infoln("Aborted.")
+				return
+			}
+		}
+		outcomes := env.ApplySync(steps)
+		env.PrintSyncOutcomes(os.Stdout, outcomes)
+		if err := env.UpdateLock(); err != nil {
+			log.Errorf("Cannot update env.lock: %s\n", err)
+		}
+		if env.HasSyncFailures(outcomes) {
+			os.Exit(1)
 		}
 	},
 }
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/log"
+	"github.com/thylong/ian/pkg/repo"
+)
+
+var repoRemoveYes bool
+var repoParallelism int
+var repoStatusOutput string
+
+func init() {
+	repoStatusCmd.Flags().StringVarP(&repoStatusOutput, "output", "o", "table", "Output format of the overview (table or json)")
+	for _, c := range []*cobra.Command{repoFetchCmd, repoPullCmd, repoStatusCmd, repoSyncCmd} {
+		c.Flags().IntVarP(&repoParallelism, "jobs", "j", 0, "Number of repositories processed concurrently (default repositories_parallelism or 8)")
+	}
+	repoRemoveCmd.Flags().BoolVarP(&repoRemoveYes, "yes", "y", false, "Remove without asking for confirmation")
+
+	repoCmd.AddCommand(
+		repoListCmd,
+		repoCloneCmd,
+		repoCleanCmd,
+		repoFetchCmd,
+		repoPullCmd,
+		repoRemoveCmd,
+		repoStatusCmd,
+		repoSyncCmd,
+		repoExportCmd,
+	)
+	RootCmd.AddCommand(repoCmd)
+}
+
+// exitOnError logs the error and exits with a non-zero status code.
+func exitOnError(err error) {
+	if err != nil {
+		log.Errorln(err)
+		os.Exit(1)
+	}
+}
+
+// printRepoResults prints the results of a bulk operation and exits with a
+// non-zero status code if any repository failed.
+func printRepoResults(results []repo.Result, err error) {
+	exitOnError(err)
+	repo.PrintResults(os.Stdout, results)
+	if repo.HasFailures(results) {
+		os.Exit(1)
+	}
+}
+
+var repoCmd = &cobra.Command{
+	Use:   "repo",
+	Short: "Manage repositories",
+	Long:  `Manage the repositories located in repositories_path.`,
+}
+
+var repoListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List local repositories",
+	Long:  `List the repositories located in repositories_path.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(repo.List())
+	},
+}
+
+var repoCloneCmd = &cobra.Command{
+	Use:   "clone <repository>",
+	Short: "Clone a repository",
+	Long:  `Clone a repository into repositories_path.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(repo.Clone(args[0]))
+	},
+}
+
+var repoCleanCmd = &cobra.Command{
+	Use:   "clean <repository>",
+	Short: "Remove untracked files from a repository",
+	Long:  `Remove untracked and ignored files from a repository (git clean -dffx).`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(repo.Clean(args[0]))
+	},
+}
+
+var repoFetchCmd = &cobra.Command{
+	Use:   "fetch [repository]",
+	Short: "Fetch one or all repositories",
+	Long:  `Fetch the given repository or every repository in repositories_path.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			printRepoResults(repo.UpdateAll(repoParallelism))
+			return
+		}
+		exitOnError(repo.UpdateOne(args[0]))
+	},
+}
+
+var repoPullCmd = &cobra.Command{
+	Use:   "pull [repository]",
+	Short: "Pull one or all repositories",
+	Long:  `Pull (with rebase) the given repository or every repository in repositories_path.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			printRepoResults(repo.UpgradeAll(repoParallelism))
+			return
+		}
+		exitOnError(repo.UpgradeOne(args[0]))
+	},
+}
+
+var repoRemoveCmd = &cobra.Command{
+	Use:   "rm <repository>",
+	Short: "Remove a local repository",
+	Long:  `Remove a repository from repositories_path.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repositoryPath, err := repo.GetRepositoryPath(args[0])
+		exitOnError(err)
+
+		if !repoRemoveYes {
+			in := strings.ToLower(config.GetUserInput(fmt.Sprintf("Remove %s? (y/N)", repositoryPath)))
+			if in != "y" && in != "yes" {
+				log.Infoln("Aborted.")
+				return
+			}
+		}
+		exitOnError(repo.Remove(args[0]))
+		log.Infof("%s removed\n", repositoryPath)
+	},
+}
+
+var repoStatusCmd = &cobra.Command{
+	Use:   "status [repository]",
+	Short: "Show the status of one or all repositories",
+	Long: `Show the git status of the given repository, or an overview of every
+repository in repositories_path (branch, ahead/behind upstream, uncommitted
+changes, stashes and last commit age).`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 {
+			exitOnError(repo.Status(args[0]))
+			return
+		}
+
+		if repoStatusOutput != "table" && repoStatusOutput != "json" {
+			exitOnError(fmt.Errorf("Unknown output format %s", repoStatusOutput))
+		}
+		statuses, err := repo.StatusAll(repoParallelism)
+		exitOnError(err)
+		if repoStatusOutput == "json" {
+			exitOnError(repo.PrintStatusesJSON(os.Stdout, statuses))
+			return
+		}
+		repo.PrintStatuses(os.Stdout, statuses)
+	},
+}
+
+var repoSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Synchronize repositories with the repositories manifest",
+	Long: `Clone the repositories of the config.yml repositories section that are
+missing from repositories_path, fetch the existing ones and report the
+repositories that are not part of the manifest.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		results, extras, err := repo.Sync(repoParallelism)
+		exitOnError(err)
+		repo.PrintResults(os.Stdout, results)
+		repo.PrintExtras(os.Stdout, extras)
+		if repo.HasFailures(results) {
+			os.Exit(1)
+		}
+	},
+}
+
+var repoExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write the repositories manifest from repositories_path",
+	Long: `Scan repositories_path and add every repository (origin remote and current
+branch) to the repositories section of config.yml, so the next ian restore
+reproduces the same layout.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		added, updated, err := repo.Export()
+		exitOnError(err)
+		if len(added) == 0 && len(updated) == 0 {
+			log.Infoln("Repositories manifest is up to date.")
+			return
+		}
+		if len(added) > 0 {
+			log.Infof("Added to the repositories manifest: %s\n", strings.Join(added, ", "))
+		}
+		if len(updated) > 0 {
+			log.Infof("Updated in the repositories manifest: %s\n", strings.Join(updated, ", "))
+		}
+	},
+}
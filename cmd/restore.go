@@ -1,12 +1,30 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 	"github.com/thylong/ian/pkg/env"
 	"github.com/thylong/ian/pkg/log"
 )
 
+var restoreConflict string
+var restoreFrozen bool
+var restoreReinstall bool
+var restoreUpgrade bool
+var restoreOutput string
+var restoreReport string
+
 func init() {
+	restore.Flags().StringVar(&restoreConflict, "conflict", "", "What to do with existing dotfiles: skip, backup, overwrite or prompt (default dotfiles.conflict or backup)")
+	restore.Flags().BoolVar(&restoreFrozen, "frozen", false, "Install the versions of env.lock and fail if the installed versions don't match")
+	restore.Flags().BoolVar(&restoreReinstall, "reinstall", false, "Install every package, even the ones already installed")
+	restore.Flags().BoolVar(&restoreUpgrade, "upgrade", false, "Upgrade the packages already installed")
+	restore.Flags().StringVarP(&restoreOutput, "output", "o", "table", "Output format of the report (table or json)")
+	restore.Flags().StringVar(&restoreReport, "report", env.RestoreReportPath, "Path of the JSON report of the restore")
+
 	RootCmd.AddCommand(restore)
 }
 
@@ -14,9 +32,56 @@ func init() {
 var restore = &cobra.Command{
 	Use:   "restore",
 	Short: "Restore ian configuration",
-	Long:  `Ian requires you to be able to interact with Github through Git CLI.`,
+	Long: `Restore the dotfiles, the packages of env.yml and the repositories of
+config.yml on this machine.
+
+The installed versions of the packages of env.yml are recorded in env.lock,
+per platform. With --frozen, the versions of env.lock are installed instead and
+the restore fails if the installed versions don't match them.
+
+Packages already installed at a version satisfying env.yml are left as they
+are, so that running restore again only installs what's missing. Use
+--reinstall to install them again, or --upgrade to upgrade them.
+
+The outcome of every package (installed, upgraded, already present, failed or
+skipped) is reported and written as JSON to the report file. The restore exits
+with 1 if a package failed.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		env.Restore(OSPackageManager)
+		if restoreOutput != "table" && restoreOutput != "json" {
+			exitOnError(fmt.Errorf("Unknown output format %s", restoreOutput))
+		}
+		if restoreReinstall && restoreUpgrade {
+			exitOnError(errors.New("--reinstall and --upgrade are mutually exclusive"))
+		}
+		if restoreFrozen && (restoreReinstall || restoreUpgrade) {
+			exitOnError(errors.New("--frozen can't be used with --reinstall or --upgrade"))
+		}
+		opts := env.RestoreOptions{Conflict: restoreConflict, Frozen: restoreFrozen, Mode: env.InstallMissing}
+		if restoreReinstall {
+			opts.Mode = env.InstallReinstall
+		} else if restoreUpgrade {
+			opts.Mode = env.InstallUpgrade
+		}
+		report, err := env.Restore(OSPackageManager, opts)
+		if err != nil {
+			log.Errorf("Restore command failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		if restoreOutput == "json" {
+			exitOnError(env.PrintRestoreReportJSON(os.Stdout, report))
+		} else {
+			env.PrintRestoreReport(os.Stdout, report)
+		}
+		if restoreReport != "" {
+			if err := env.WriteRestoreReport(restoreReport, report); err != nil {
+				log.Errorf("Cannot write the restore report: %s\n", err)
+			}
+		}
+		if report.HasFailures() {
+			log.Errorln("Some packages couldn't be installed.")
+			os.Exit(1)
+		}
 
 		log.Infoln("Great! You're ready to start using Ian.")
 	},
@@ -3,6 +3,8 @@ package cmd
 import (
 	"os"
 
+	"github.com/thylong/ian/pkg/dryrun"
+	"github.com/thylong/ian/pkg/env"
 	"github.com/thylong/ian/pkg/log"
 
 	"github.com/spf13/cobra"
@@ -12,6 +14,8 @@ import (
 // OSPackageManager is the main package manager used by the current OS.
 var OSPackageManager pm.PackageManager
 
+var dryRun bool
+
 func init() {
 	var err error
 	OSPackageManager, err = pm.GetOSPackageManager()
@@ -19,9 +23,8 @@ func init() {
 		log.Errorf("%s\n", err)
 		os.Exit(1)
 	}
-	if !OSPackageManager.IsInstalled() {
-		OSPackageManager.Setup()
-	}
+
+	RootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the commands, file changes and git operations instead of performing them")
 }
 
 // RootCmd is executed by default (top level).
@@ -32,4 +35,19 @@ var RootCmd = &cobra.Command{
 	CompletionOptions: cobra.CompletionOptions{
 		DisableDefaultCmd: true,
 	},
+	// The OS package manager is set up once the flags are parsed, so that
+	// it's recorded in dry run.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if dryRun {
+			env.EnableDryRun(os.Stdout)
+		}
+		if !OSPackageManager.IsInstalled() {
+			OSPackageManager.Setup()
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		if dryRun {
+			log.Infof("Dry run: %d operations recorded, nothing was changed.\n", len(dryrun.Operations()))
+		}
+	},
 }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/thylong/ian/pkg/dryrun"
 	"github.com/thylong/ian/pkg/log"
 
 	"github.com/mitchellh/ioprogress"
@@ -86,18 +87,18 @@ var selfUpdateCmd = &cobra.Command{
 			// in case the upgrade fails
 			destBackup := dest + ".bak"
 			if _, err := os.Stat(dest); err == nil {
-				os.Rename(dest, destBackup)
+				dryrun.Rename(dest, destBackup)
 			}
 
 			log.Infof("Downloading ian's new version to %s\n", dest)
-			if err := ioutil.WriteFile(dest, data, 0755); err != nil {
-				os.Rename(destBackup, dest)
+			if err := dryrun.WriteFile(dest, data, 0755); err != nil {
+				dryrun.Rename(destBackup, dest)
 				log.Errorln("Failed to update ian")
 				return
 			}
 
 			// Removing backup
-			os.Remove(destBackup)
+			dryrun.Remove(destBackup)
 
 			log.Infof("ian updated with success to version %s\n", remoteVersion)
 		} else {
@@ -16,20 +16,63 @@ package command
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
 
+	"github.com/thylong/ian/pkg/dryrun"
 	"github.com/thylong/ian/pkg/log"
 )
 
 // ErrStartCommand is returned when failing to start command
 var ErrStartCommand = errors.New("Impossible to start Cmd")
 
+// outputPrefixes contains the prefix of the output lines of ExecuteCommand
+// per executable path.
+var outputPrefixes = struct {
+	sync.RWMutex
+	prefixes map[string]string
+}{prefixes: make(map[string]string)}
+
+// SetOutputPrefix prefixes the output lines of the commands of an executable
+// run by ExecuteCommand, to tell apart the output of concurrent commands.
+// An empty prefix removes it.
+func SetOutputPrefix(path string, prefix string) {
+	outputPrefixes.Lock()
+	defer outputPrefixes.Unlock()
+	if prefix == "" {
+		delete(outputPrefixes.prefixes, path)
+		return
+	}
+	outputPrefixes.prefixes[path] = prefix
+}
+
+// outputPrefix returns the prefix of the output lines of an executable.
+func outputPrefix(path string) string {
+	outputPrefixes.RLock()
+	defer outputPrefixes.RUnlock()
+	return outputPrefixes.prefixes[path]
+}
+
+// recordCommand records subCmd in dry run, in which case it must not run.
+func recordCommand(subCmd *exec.Cmd) bool {
+	if subCmd.Dir != "" {
+		return dryrun.Record("run", "%s (in %s)", strings.Join(subCmd.Args, " "), subCmd.Dir)
+	}
+	return dryrun.Record("run", "%s", strings.Join(subCmd.Args, " "))
+}
+
 // ExecuteCommand a command and print output from stdout.
+// In dry run, the command is recorded instead.
 func ExecuteCommand(subCmd *exec.Cmd) (err error) {
+	if recordCommand(subCmd) {
+		return nil
+	}
 	cmdOutReader, err := subCmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("Impossible to create StdoutPipe for Cmd: %v", err)
@@ -39,11 +82,20 @@ func ExecuteCommand(subCmd *exec.Cmd) (err error) {
 		return fmt.Errorf("Impossible to create StderrPipe for Cmd: %v", err)
 	}
 
+	prefix := outputPrefix(subCmd.Path)
+	var stderr bytes.Buffer
+	var wg sync.WaitGroup
 	for _, cmdReader := range []io.ReadCloser{cmdOutReader, cmdErrReader} {
 		scanner := bufio.NewScanner(cmdReader)
+		isStderr := cmdReader == cmdErrReader
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			for scanner.Scan() {
-				fmt.Printf("%s\n", scanner.Text())
+				fmt.Printf("%s%s\n", prefix, scanner.Text())
+				if isStderr {
+					stderr.WriteString(scanner.Text() + "\n")
+				}
 			}
 		}()
 	}
@@ -53,16 +105,37 @@ func ExecuteCommand(subCmd *exec.Cmd) (err error) {
 		return ErrStartCommand
 	}
 
+	// The output has to be read before waiting for the command.
+	wg.Wait()
 	err = subCmd.Wait()
 	if err != nil {
-		return fmt.Errorf("Impossible to wait for Cmd: %v", err)
+		return &ExecError{Err: err, Stderr: strings.TrimSpace(stderr.String())}
 	}
 	return nil
 }
 
+// ExecError is returned when a command run by ExecuteCommand fails.
+type ExecError struct {
+	Err error
+	// Stderr is the output of the command on stderr.
+	Stderr string
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("Impossible to wait for Cmd: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
 // MustExecuteCommand a command and print output from stdout.
-// In case of stderr, return err.
+// In case of stderr, return err. In dry run, the command is recorded instead.
 func MustExecuteCommand(subCmd *exec.Cmd) (err error) {
+	if recordCommand(subCmd) {
+		return nil
+	}
 	cmdOutReader, err := subCmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("Impossible to create StdoutPipe for Cmd: %v", err)
@@ -106,11 +179,30 @@ func MustExecuteCommand(subCmd *exec.Cmd) (err error) {
 	return nil
 }
 
+// ExecuteCommandOutput a command and return its output from stdout.
+// In case of failure, the error contains the output from stderr.
+// It's meant for commands querying the system, so it also runs in dry run.
+func ExecuteCommandOutput(subCmd *exec.Cmd) (string, error) {
+	var stderr bytes.Buffer
+	subCmd.Stderr = &stderr
+	out, err := subCmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return string(out), fmt.Errorf("%v: %s", err, msg)
+		}
+		return string(out), err
+	}
+	return string(out), nil
+}
+
 // ExecuteInteractiveCommand a command and print concurrently output from stdout
-// & stderr.
-func ExecuteInteractiveCommand(subCmd *exec.Cmd) {
+// & stderr. In dry run, the command is recorded instead.
+func ExecuteInteractiveCommand(subCmd *exec.Cmd) error {
+	if recordCommand(subCmd) {
+		return nil
+	}
 	subCmd.Stdout = os.Stdout
 	subCmd.Stdin = os.Stdin
 	subCmd.Stderr = os.Stderr
-	subCmd.Run()
+	return subCmd.Run()
 }
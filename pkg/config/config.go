@@ -27,6 +27,7 @@ import (
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/spf13/viper"
+	"github.com/thylong/ian/pkg/dryrun"
 	"github.com/thylong/ian/pkg/log"
 )
 
@@ -48,7 +49,7 @@ var Vipers map[string]*viper.Viper
 // YamlConfigMap is used to marshal/unmarshal config file.
 type YamlConfigMap struct {
 	Managers     map[string]map[string]string `json:"managers"`
-	Repositories map[string]string            `json:"repositories"`
+	Repositories map[string]RepositoryConfig  `json:"repositories"`
 	Setup        map[string][]string          `json:"setup"`
 	Packages     map[string]map[string]string `json:"packages"`
 }
@@ -130,7 +131,7 @@ Learn more about Ian at http://goian.io
 
 To benefit from all of Ian’s features, you’ll need to provide:
 - The full path of your repositories (example: /Users/thylong/repositories)
-- The path of your dotfiles Github repository (example: thylong/dotfiles)
+- The path of your dotfiles repository (example: thylong/dotfiles or gitlab.com:thylong/dotfiles)
 
 `)
 }
@@ -159,7 +160,7 @@ func SetupConfigFile(ConfigFileName string) {
 		}
 
 		log.Infof("Creating %s\n", ConfigFileName)
-		if err := ioutil.WriteFile(ConfigFilePath, configContent, 0766); err != nil {
+		if err := dryrun.WriteFile(ConfigFilePath, configContent, 0766); err != nil {
 			log.Errorf("%s\n", err)
 			os.Exit(1)
 		}
@@ -179,6 +180,9 @@ func SetupConfigFiles() {
 // and write it as new line(s) in the given conf file.
 func AppendToConfig(lines string, confFilename string) {
 	confPath := ConfigFilesPathes[confFilename]
+	if dryrun.Record("write", "%s", confPath) {
+		return
+	}
 	f, err := os.OpenFile(confPath, os.O_APPEND|os.O_WRONLY, 0600)
 	if err != nil {
 		log.Errorln("%s\n", err)
@@ -205,7 +209,7 @@ func UpdateYamlFile(fileFullPath string, fileContent map[string]interface{}) {
 		log.Errorf("Failed to update %s\n", fileFullPath)
 		os.Exit(1)
 	}
-	if err := ioutil.WriteFile(fileFullPath, out, 0766); err != nil {
+	if err := dryrun.WriteFile(fileFullPath, out, 0766); err != nil {
 		log.Errorf("Failed to update %s\n", fileFullPath)
 		os.Exit(1)
 	}
@@ -236,6 +240,49 @@ func GetDotfilesRepositoryPath() string {
 	return Vipers["config"].GetStringMapString("dotfiles")["repository"]
 }
 
+// GetDotfilesProvider returns the dotfiles repository provider (github by default).
+func GetDotfilesProvider() string {
+	if provider := Vipers["config"].GetStringMapString("dotfiles")["provider"]; provider != "" {
+		return provider
+	}
+	return "github"
+}
+
+// GetDotfilesHost returns the dotfiles repository host, if set.
+// It's required for self-hosted providers.
+func GetDotfilesHost() string {
+	return Vipers["config"].GetStringMapString("dotfiles")["host"]
+}
+
+// GetDotfilesBranch returns the dotfiles repository branch (master by default).
+func GetDotfilesBranch() string {
+	if branch := Vipers["config"].GetStringMapString("dotfiles")["branch"]; branch != "" {
+		return branch
+	}
+	return "master"
+}
+
+// GetDotfilesLink returns how dotfiles directories are linked (file or directory).
+func GetDotfilesLink() string {
+	return Vipers["config"].GetStringMapString("dotfiles")["link"]
+}
+
+// GetDotfilesConflict returns what to do with existing files when linking
+// dotfiles (skip, backup, overwrite or prompt).
+func GetDotfilesConflict() string {
+	return Vipers["config"].GetStringMapString("dotfiles")["conflict"]
+}
+
+// GetDotfilesIncludes returns the dotfiles.include glob patterns.
+func GetDotfilesIncludes() []string {
+	return Vipers["config"].GetStringSlice("dotfiles.include")
+}
+
+// GetDotfilesExcludes returns the dotfiles.exclude glob patterns.
+func GetDotfilesExcludes() []string {
+	return Vipers["config"].GetStringSlice("dotfiles.exclude")
+}
+
 // GetDefaultSaveMessage returns as a string the default save message.
 func GetDefaultSaveMessage() string {
 	return Vipers["config"].GetString("default_save_message")
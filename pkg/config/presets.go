@@ -17,6 +17,7 @@ package config
 import (
 	"os"
 
+	"github.com/thylong/ian/pkg/dryrun"
 	"github.com/thylong/ian/pkg/log"
 )
 
@@ -43,14 +44,7 @@ func CreateEnvFileWithPreset(preset string) {
 	}
 
 	confPath := ConfigFilesPathes["env"]
-	f, err := os.OpenFile(confPath, os.O_CREATE|os.O_WRONLY, 0655)
-	if err != nil {
-		log.Errorln(err)
-		os.Exit(1)
-	}
-	defer f.Close()
-
-	if _, err = f.WriteString(Envcontent); err != nil {
+	if err := dryrun.WriteFile(confPath, []byte(Envcontent), 0655); err != nil {
 		log.Errorln(err)
 		os.Exit(1)
 	}
@@ -0,0 +1,112 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"sort"
+
+	"github.com/thylong/ian/pkg/dryrun"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RepositoryConfig describes a repository of the repositories manifest.
+type RepositoryConfig struct {
+	// Remote is the URL the repository is cloned from.
+	Remote string `yaml:"remote" json:"remote"`
+	// Path is the location of the repository relative to repositories_path
+	// (defaults to the repository name).
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Branch is the branch checked out when cloning (defaults to the remote HEAD).
+	Branch string `yaml:"branch,omitempty" json:"branch,omitempty"`
+}
+
+// UnmarshalYAML accepts both the mapping form and a bare remote URL.
+func (repository *RepositoryConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var remote string
+	if err := unmarshal(&remote); err == nil {
+		*repository = RepositoryConfig{Remote: remote}
+		return nil
+	}
+	type plain RepositoryConfig
+	return unmarshal((*plain)(repository))
+}
+
+// GetRepositoriesManifest returns the repositories section of config.yml,
+// with every Path defaulting to the repository name.
+func GetRepositoriesManifest() (map[string]RepositoryConfig, error) {
+	configContent, err := ioutil.ReadFile(ConfigFilesPathes["config"])
+	if err != nil {
+		return nil, err
+	}
+	var content struct {
+		Repositories map[string]RepositoryConfig `yaml:"repositories"`
+	}
+	if err := yaml.Unmarshal(configContent, &content); err != nil {
+		return nil, err
+	}
+	for name, repository := range content.Repositories {
+		if repository.Path == "" {
+			repository.Path = name
+			content.Repositories[name] = repository
+		}
+	}
+	return content.Repositories, nil
+}
+
+// SaveRepositoriesManifest writes the repositories section of config.yml,
+// leaving the other settings untouched.
+func SaveRepositoriesManifest(manifest map[string]RepositoryConfig) error {
+	configFilePath := ConfigFilesPathes["config"]
+	configContent, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		return err
+	}
+	var content yaml.MapSlice
+	if err := yaml.Unmarshal(configContent, &content); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range manifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var repositories yaml.MapSlice
+	for _, name := range names {
+		repository := manifest[name]
+		if repository.Path == name {
+			repository.Path = ""
+		}
+		repositories = append(repositories, yaml.MapItem{Key: name, Value: repository})
+	}
+
+	replaced := false
+	for i, item := range content {
+		if item.Key == "repositories" {
+			content[i].Value = repositories
+			replaced = true
+		}
+	}
+	if !replaced {
+		content = append(content, yaml.MapItem{Key: "repositories", Value: repositories})
+	}
+
+	out, err := yaml.Marshal(content)
+	if err != nil {
+		return err
+	}
+	return dryrun.WriteFile(configFilePath, out, 0766)
+}
@@ -0,0 +1,266 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
+	"github.com/thylong/ian/pkg/env"
+	pm "github.com/thylong/ian/pkg/package-managers"
+	"github.com/thylong/ian/pkg/repo"
+)
+
+func init() {
+	Register(Check{Name: "config", Run: checkConfig, Fix: fixConfig})
+	Register(Check{Name: "os package manager", Run: checkOSPackageManager})
+	Register(Check{Name: "package managers", Run: checkPackageManagers})
+	Register(Check{Name: "package versions", Run: checkPackageVersions})
+	Register(Check{Name: "packages", Run: checkPackages})
+	Register(Check{Name: "dotfiles directory", Run: checkDotfilesDir})
+	Register(Check{Name: "dotfiles remote", Run: checkDotfilesRemote})
+	Register(Check{Name: "dotfiles save", Run: checkInterruptedSave})
+	Register(Check{Name: "dotfiles links", Run: checkDanglingDotfiles, Fix: fixDanglingDotfiles})
+	Register(Check{Name: "repositories", Run: checkRepositories, Fix: fixRepositories})
+}
+
+// checkConfig checks repositories_path and the dotfiles options of config.yml.
+func checkConfig() Result {
+	if _, err := env.GetLinkOptions(""); err != nil {
+		return Result{Status: StatusFail, Message: err.Error(), Hint: fmt.Sprintf("edit %s", config.ConfigFilesPathes["config"])}
+	}
+	repositoriesPath, err := repo.GetRepositoriesPath()
+	if err != nil {
+		return Result{Status: StatusWarn, Message: err.Error(), Hint: fmt.Sprintf("set repositories_path in %s", config.ConfigFilesPathes["config"])}
+	}
+	if fi, err := os.Stat(repositoriesPath); err != nil || !fi.IsDir() {
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("repositories_path %s doesn't exist", repositoriesPath), Hint: "create it or fix repositories_path"}
+	}
+	return Result{Status: StatusPass, Message: "config.yml is valid"}
+}
+
+// fixConfig creates the repositories_path directory.
+func fixConfig() error {
+	repositoriesPath, err := repo.GetRepositoriesPath()
+	if err != nil {
+		return err
+	}
+	return dryrun.MkdirAll(repositoriesPath, 0755)
+}
+
+// checkOSPackageManager checks the OS package manager is installed.
+func checkOSPackageManager() Result {
+	OSPackageManager, err := pm.GetOSPackageManager()
+	if err != nil {
+		return Result{Status: StatusFail, Message: err.Error()}
+	}
+	if !OSPackageManager.IsInstalled() {
+		return Result{Status: StatusFail, Message: fmt.Sprintf("%s is not installed", OSPackageManager.GetName()), Hint: "run ian restore"}
+	}
+	return Result{Status: StatusPass, Message: fmt.Sprintf("%s is installed", OSPackageManager.GetName())}
+}
+
+// checkPackageManagers checks the package managers of env.yml are supported
+// and installed.
+func checkPackageManagers() Result {
+	var unsupported, missing []string
+	for _, name := range config.Vipers["env"].AllKeys() {
+		if !pm.IsSupportedPackageManager(name) {
+			unsupported = append(unsupported, name)
+		} else if !pm.GetPackageManager(name).IsInstalled() {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(unsupported)
+	sort.Strings(missing)
+	if len(unsupported) > 0 {
+		return Result{Status: StatusFail, Message: fmt.Sprintf("unsupported package managers in env.yml: %s", strings.Join(unsupported, ", ")), Hint: fmt.Sprintf("edit %s", config.ConfigFilesPathes["env"])}
+	}
+	if len(missing) > 0 {
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("package managers of env.yml not installed: %s", strings.Join(missing, ", ")), Hint: "install them, then run ian restore"}
+	}
+	return Result{Status: StatusPass, Message: "package managers of env.yml are installed"}
+}
+
+// checkPackageVersions checks the packages of env.yml can be installed with
+// their version constraint by their package manager.
+func checkPackageVersions() Result {
+	errs := env.ValidatePackages()
+	if len(errs) == 0 {
+		return Result{Status: StatusPass, Message: "version constraints of env.yml are supported"}
+	}
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return Result{Status: StatusFail, Message: strings.Join(messages, "; "), Hint: fmt.Sprintf("edit %s", config.ConfigFilesPathes["env"])}
+}
+
+// checkPackages checks the packages of env.yml are installed. Package
+// managers that aren't installed are left to checkPackageManagers.
+func checkPackages() Result {
+	packageManagers := config.Vipers["env"].AllKeys()
+	sort.Strings(packageManagers)
+	var missing []string
+	for _, name := range packageManagers {
+		if !pm.IsSupportedPackageManager(name) || !pm.GetPackageManager(name).IsInstalled() {
+			continue
+		}
+		declared, err := env.GetDeclaredPackages(name)
+		if err != nil {
+			return Result{Status: StatusFail, Message: err.Error(), Hint: fmt.Sprintf("edit %s", config.ConfigFilesPathes["env"])}
+		}
+		installed, err := pm.GetPackageManager(name).ListInstalled()
+		if err != nil {
+			return Result{Status: StatusWarn, Message: fmt.Sprintf("cannot list the %s packages: %s", name, err)}
+		}
+		if packages := env.MissingPackages(name, declared, installed); len(packages) > 0 {
+			missing = append(missing, fmt.Sprintf("%s (%s)", strings.Join(packages, ", "), name))
+		}
+	}
+	if len(missing) > 0 {
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("packages of env.yml not installed: %s", strings.Join(missing, ", ")), Hint: "run ian restore, or ian env diff for details"}
+	}
+	return Result{Status: StatusPass, Message: "packages of env.yml are installed"}
+}
+
+// checkDotfilesDir checks the dotfiles directory is a git repository.
+func checkDotfilesDir() Result {
+	if _, err := os.Stat(config.DotfilesDirPath); err != nil {
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("%s doesn't exist", config.DotfilesDirPath), Hint: "run ian restore to get your dotfiles, or ian save to save them"}
+	}
+	if _, err := os.Stat(filepath.Join(config.DotfilesDirPath, ".git")); err != nil {
+		return Result{Status: StatusFail, Message: fmt.Sprintf("%s is not a git repository", config.DotfilesDirPath), Hint: "move it away, then run ian restore"}
+	}
+	return Result{Status: StatusPass, Message: fmt.Sprintf("%s is a git repository", config.DotfilesDirPath)}
+}
+
+// checkDotfilesRemote checks the dotfiles repository is reachable.
+func checkDotfilesRemote() Result {
+	repository := config.GetDotfilesRepositoryPath()
+	if repository == "" {
+		return Result{Status: StatusWarn, Message: "dotfiles.repository is not set", Hint: fmt.Sprintf("set it in %s", config.ConfigFilesPathes["config"])}
+	}
+	remote, err := env.GetDotfilesRemote(repository)
+	if err != nil {
+		return Result{Status: StatusFail, Message: err.Error(), Hint: "check dotfiles.repository, dotfiles.provider and dotfiles.host"}
+	}
+	if err := env.Git.LsRemote(remote.SSHURL()); err != nil {
+		return Result{Status: StatusFail, Message: fmt.Sprintf("%s is not reachable: %s", remote.SSHURL(), err), Hint: "check your network and that your SSH key is added to the provider"}
+	}
+	return Result{Status: StatusPass, Message: fmt.Sprintf("%s is reachable", remote.SSHURL())}
+}
+
+// checkInterruptedSave checks no dotfiles import has been interrupted.
+func checkInterruptedSave() Result {
+	journal, err := env.LoadJournal(env.ImportJournalPath)
+	if err != nil {
+		return Result{Status: StatusFail, Message: fmt.Sprintf("cannot read %s: %s", env.ImportJournalPath, err)}
+	}
+	if journal != nil {
+		return Result{Status: StatusFail, Message: "a previous save has been interrupted", Hint: "run ian save --resume or ian save --rollback"}
+	}
+	return Result{Status: StatusPass, Message: "no interrupted save"}
+}
+
+// checkDanglingDotfiles checks no symlink points to a removed dotfile.
+func checkDanglingDotfiles() Result {
+	dangling, err := findDanglingDotfiles()
+	if err != nil {
+		return Result{Status: StatusWarn, Message: err.Error()}
+	}
+	if len(dangling) > 0 {
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("dangling symlinks into the dotfiles directory: %s", strings.Join(dangling, ", ")), Hint: "remove them"}
+	}
+	return Result{Status: StatusPass, Message: "no dangling symlinks into the dotfiles directory"}
+}
+
+// fixDanglingDotfiles removes the symlinks pointing to removed dotfiles.
+func fixDanglingDotfiles() error {
+	usr, err := user.Current()
+	if err != nil {
+		return err
+	}
+	dangling, err := findDanglingDotfiles()
+	if err != nil {
+		return err
+	}
+	for _, name := range dangling {
+		if err := dryrun.Remove(filepath.Join(usr.HomeDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findDanglingDotfiles returns the dangling symlinks into the dotfiles directory.
+func findDanglingDotfiles() ([]string, error) {
+	if _, err := os.Stat(config.DotfilesDirPath); err != nil {
+		return nil, nil
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	return env.FindDanglingDotfiles(config.DotfilesDirPath, usr.HomeDir)
+}
+
+// checkRepositories checks the repositories of the manifest are cloned.
+func checkRepositories() Result {
+	manifest, err := config.GetRepositoriesManifest()
+	if err != nil {
+		return Result{Status: StatusFail, Message: err.Error(), Hint: fmt.Sprintf("fix the repositories section of %s", config.ConfigFilesPathes["config"])}
+	}
+	var missing, invalid []string
+	for name, repository := range manifest {
+		repositoryPath, err := repo.GetRepositoryPath(repository.Path)
+		if err != nil {
+			invalid = append(invalid, name)
+		} else if _, err := os.Stat(repositoryPath); err != nil {
+			missing = append(missing, name)
+		} else if _, err := os.Stat(filepath.Join(repositoryPath, ".git")); err != nil {
+			invalid = append(invalid, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(invalid)
+	if len(invalid) > 0 {
+		return Result{Status: StatusFail, Message: fmt.Sprintf("repositories with an invalid path or not a git repository: %s", strings.Join(invalid, ", ")), Hint: "fix their path in the repositories section of config.yml"}
+	}
+	if len(missing) > 0 {
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("repositories not cloned: %s", strings.Join(missing, ", ")), Hint: "run ian repo sync"}
+	}
+	return Result{Status: StatusPass, Message: fmt.Sprintf("%d repositories cloned", len(manifest))}
+}
+
+// fixRepositories clones the missing repositories of the manifest.
+func fixRepositories() error {
+	results, _, err := repo.Sync(0)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Failed() {
+			return fmt.Errorf("%s: %s", result.Repository, result.Err)
+		}
+	}
+	return nil
+}
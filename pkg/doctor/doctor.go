@@ -0,0 +1,130 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// StatusPass means nothing is wrong.
+	StatusPass Status = "pass"
+	// StatusWarn means something may not work as expected.
+	StatusWarn Status = "warn"
+	// StatusFail means something is broken.
+	StatusFail Status = "fail"
+)
+
+// Result is the outcome of a check.
+type Result struct {
+	Check   string
+	Status  Status
+	Message string
+	// Hint explains how to remediate a warning or a failure.
+	Hint string
+	// Fixable is set when the check has a fix that hasn't been run.
+	Fixable bool
+	// Fixed is set when the check passes after running its fix.
+	Fixed bool
+	// FixErr is the error returned by the fix, if any.
+	FixErr error
+}
+
+// Check inspects one part of the environment.
+type Check struct {
+	Name string
+	Run  func() Result
+	// Fix remediates a warning or a failure. It's only set when it's safe to
+	// run without asking.
+	Fix func() error
+}
+
+// Checks is the registry of the checks run by ian doctor, in order.
+var Checks []Check
+
+// Register adds a check to the registry.
+func Register(check Check) {
+	Checks = append(Checks, check)
+}
+
+// Run runs the registered checks. With fix, the fixable warnings and
+// failures are fixed then checked again.
+func Run(fix bool) (results []Result) {
+	for _, check := range Checks {
+		results = append(results, runCheck(check, fix))
+	}
+	return results
+}
+
+// runCheck runs check, fixing it if needed and asked to.
+func runCheck(check Check, fix bool) Result {
+	result := check.Run()
+	result.Check = check.Name
+	if result.Status == StatusPass || check.Fix == nil {
+		return result
+	}
+	if !fix {
+		result.Fixable = true
+		return result
+	}
+	if err := check.Fix(); err != nil {
+		result.FixErr = err
+		return result
+	}
+	result = check.Run()
+	result.Check = check.Name
+	result.Fixed = result.Status == StatusPass
+	return result
+}
+
+// HasFailures returns true if a check failed.
+func HasFailures(results []Result) bool {
+	for _, result := range results {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintResults writes the results as a table followed by a summary.
+func PrintResults(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	counts := make(map[Status]int)
+	for _, result := range results {
+		counts[result.Status]++
+		message := result.Message
+		if result.Fixed {
+			message += " (fixed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Status, result.Check, message)
+		if result.Status != StatusPass && result.Hint != "" {
+			fmt.Fprintf(tw, "\t\thint: %s\n", result.Hint)
+		}
+		if result.FixErr != nil {
+			fmt.Fprintf(tw, "\t\tfix failed: %s\n", result.FixErr)
+		}
+		if result.Fixable {
+			fmt.Fprintf(tw, "\t\tfixable with ian doctor --fix\n")
+		}
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed\n", counts[StatusPass], counts[StatusWarn], counts[StatusFail])
+}
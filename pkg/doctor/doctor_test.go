@@ -0,0 +1,88 @@
+package doctor
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	defer func(checks []Check) { Checks = checks }(Checks)
+	Checks = nil
+
+	fixed := false
+	Register(Check{Name: "pass", Run: func() Result { return Result{Status: StatusPass} }})
+	Register(Check{
+		Name: "fixable",
+		Run: func() Result {
+			if fixed {
+				return Result{Status: StatusPass}
+			}
+			return Result{Status: StatusWarn}
+		},
+		Fix: func() error { fixed = true; return nil },
+	})
+	Register(Check{
+		Name: "broken fix",
+		Run:  func() Result { return Result{Status: StatusFail} },
+		Fix:  func() error { return errors.New("broken") },
+	})
+	Register(Check{Name: "unfixable", Run: func() Result { return Result{Status: StatusFail} }})
+
+	cases := []struct {
+		Fix      bool
+		Expected []Result
+	}{
+		{false, []Result{
+			{Check: "pass", Status: StatusPass},
+			{Check: "fixable", Status: StatusWarn, Fixable: true},
+			{Check: "broken fix", Status: StatusFail, Fixable: true},
+			{Check: "unfixable", Status: StatusFail},
+		}},
+		{true, []Result{
+			{Check: "pass", Status: StatusPass},
+			{Check: "fixable", Status: StatusPass, Fixed: true},
+			{Check: "broken fix", Status: StatusFail, FixErr: errors.New("broken")},
+			{Check: "unfixable", Status: StatusFail},
+		}},
+	}
+	for _, tc := range cases {
+		results := Run(tc.Fix)
+		if len(results) != len(tc.Expected) {
+			t.Fatalf("Run func returned wrong number of results: got %d want %d", len(results), len(tc.Expected))
+		}
+		for i, result := range results {
+			expected := tc.Expected[i]
+			if result.Check != expected.Check || result.Status != expected.Status || result.Fixable != expected.Fixable ||
+				result.Fixed != expected.Fixed || (result.FixErr == nil) != (expected.FixErr == nil) {
+				t.Errorf("Run func with fix %t returned wrong result: got %#v want %#v", tc.Fix, result, expected)
+			}
+		}
+		if !HasFailures(results) {
+			t.Errorf("HasFailures func returned false with failing checks")
+		}
+	}
+}
+
+func TestPrintResults(t *testing.T) {
+	var buf bytes.Buffer
+	PrintResults(&buf, []Result{
+		{Check: "config", Status: StatusPass, Message: "config.yml is valid"},
+		{Check: "dotfiles links", Status: StatusWarn, Message: "dangling symlinks", Hint: "remove them", Fixable: true},
+		{Check: "repositories", Status: StatusPass, Message: "2 repositories cloned", Fixed: true},
+	})
+	out := buf.String()
+	for _, expected := range []string{
+		"pass  config",
+		"warn  dotfiles links  dangling symlinks",
+		"hint: remove them",
+		"fixable with ian doctor --fix",
+		"2 repositories cloned (fixed)",
+		"2 passed, 1 warnings, 0 failed",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("PrintResults func output doesn't contain %q:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dryrun records the changes ian would make to the system instead of
+// making them: commands run, files written, moved or removed, symlinks and
+// git operations.
+package dryrun
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Operation is a change ian would make to the system.
+type Operation struct {
+	// Kind is the kind of change: run, write, mkdir, move, remove, symlink,
+	// chmod, chown, chtimes or git.
+	Kind        string
+	Description string
+}
+
+func (o Operation) String() string {
+	return o.Kind + " " + o.Description
+}
+
+// recorder contains the recorded operations, when the dry run is enabled.
+var recorder = struct {
+	sync.Mutex
+	enabled    bool
+	out        io.Writer
+	operations []Operation
+}{}
+
+// Enable turns the dry run on: the operations are recorded and printed to out
+// (nil to discard) instead of being performed.
+func Enable(out io.Writer) {
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.enabled = true
+	recorder.out = out
+	recorder.operations = nil
+}
+
+// Disable turns the dry run off.
+func Disable() {
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.enabled = false
+	recorder.out = nil
+}
+
+// Enabled returns true if the dry run is on.
+func Enabled() bool {
+	recorder.Lock()
+	defer recorder.Unlock()
+	return recorder.enabled
+}
+
+// Record records an operation and prints it. It returns false if the dry run
+// is off, in which case the operation has to be performed.
+func Record(kind string, format string, a ...interface{}) bool {
+	recorder.Lock()
+	defer recorder.Unlock()
+	if !recorder.enabled {
+		return false
+	}
+	operation := Operation{Kind: kind, Description: fmt.Sprintf(format, a...)}
+	recorder.operations = append(recorder.operations, operation)
+	if recorder.out != nil {
+		fmt.Fprintf(recorder.out, "[dry-run] %s\n", operation)
+	}
+	return true
+}
+
+// Operations returns the operations recorded since the dry run was enabled.
+func Operations() []Operation {
+	recorder.Lock()
+	defer recorder.Unlock()
+	return append([]Operation(nil), recorder.operations...)
+}
+
+// WriteFile is os.WriteFile, recorded in dry run.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	if Record("write", "%s", name) {
+		return nil
+	}
+	return os.WriteFile(name, data, perm)
+}
+
+// MkdirAll is os.MkdirAll, recorded in dry run.
+func MkdirAll(path string, perm os.FileMode) error {
+	if Record("mkdir", "%s", path) {
+		return nil
+	}
+	return os.MkdirAll(path, perm)
+}
+
+// Rename is os.Rename, recorded in dry run.
+func Rename(oldpath string, newpath string) error {
+	if Record("move", "%s to %s", oldpath, newpath) {
+		return nil
+	}
+	return os.Rename(oldpath, newpath)
+}
+
+// Remove is os.Remove, recorded in dry run.
+func Remove(name string) error {
+	if Record("remove", "%s", name) {
+		return nil
+	}
+	return os.Remove(name)
+}
+
+// RemoveAll is os.RemoveAll, recorded in dry run.
+func RemoveAll(path string) error {
+	if Record("remove", "%s", path) {
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
+// Symlink is os.Symlink, recorded in dry run.
+func Symlink(oldname string, newname string) error {
+	if Record("symlink", "%s -> %s", newname, oldname) {
+		return nil
+	}
+	return os.Symlink(oldname, newname)
+}
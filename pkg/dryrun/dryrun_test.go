@@ -0,0 +1,82 @@
+package dryrun
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestRecord(t *testing.T) {
+	if Record("run", "brew install %s", "git") {
+		t.Errorf("Record func recorded an operation with the dry run off")
+	}
+
+	var out bytes.Buffer
+	Enable(&out)
+	defer Disable()
+	dir := t.TempDir()
+	WriteFile(filepath.Join(dir, ".vimrc"), []byte("test"), 0644)
+	Symlink(filepath.Join(dir, ".vimrc"), filepath.Join(dir, ".vimrc.link"))
+	MkdirAll(filepath.Join(dir, "nested"), 0755)
+
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("dry run changed the filesystem: %v", files)
+	}
+	expected := []Operation{
+		{Kind: "write", Description: filepath.Join(dir, ".vimrc")},
+		{Kind: "symlink", Description: filepath.Join(dir, ".vimrc.link") + " -> " + filepath.Join(dir, ".vimrc")},
+		{Kind: "mkdir", Description: filepath.Join(dir, "nested")},
+	}
+	if operations := Operations(); !reflect.DeepEqual(operations, expected) {
+		t.Errorf("Operations func returned wrong operations: got %#v want %#v", operations, expected)
+	}
+	if expected := "[dry-run] write " + filepath.Join(dir, ".vimrc") + "\n"; !bytes.HasPrefix(out.Bytes(), []byte(expected)) {
+		t.Errorf("Record func printed wrong operation: got %q want prefix %q", out.String(), expected)
+	}
+}
+
+func TestFs(t *testing.T) {
+	memFs := afero.NewMemMapFs()
+	afero.WriteFile(memFs, "/home/.vimrc", []byte("test"), 0644)
+	fs := NewFs(memFs)
+
+	Enable(nil)
+	defer Disable()
+	if err := afero.WriteFile(fs, "/home/.zshrc", []byte("test"), 0644); err != nil {
+		t.Errorf("WriteFile func failed in dry run: %s", err)
+	}
+	fs.Rename("/home/.vimrc", "/dotfiles/.vimrc")
+	fs.RemoveAll("/home")
+	fs.Chmod("/home/.vimrc", 0600)
+	fs.Chown("/home/.vimrc", 1000, 1000)
+	fs.Chtimes("/home/.vimrc", time.Time{}, time.Time{})
+
+	if content, err := afero.ReadFile(fs, "/home/.vimrc"); err != nil || string(content) != "test" {
+		t.Errorf("dry run changed /home/.vimrc: %q, %v", content, err)
+	}
+	if exists, _ := afero.Exists(memFs, "/home/.zshrc"); exists {
+		t.Errorf("dry run wrote /home/.zshrc")
+	}
+	expected := []Operation{
+		{Kind: "write", Description: "/home/.zshrc"},
+		{Kind: "move", Description: "/home/.vimrc to /dotfiles/.vimrc"},
+		{Kind: "remove", Description: "/home"},
+		{Kind: "chmod", Description: "-rw------- /home/.vimrc"},
+		{Kind: "chown", Description: "1000:1000 /home/.vimrc"},
+		{Kind: "chtimes", Description: "/home/.vimrc"},
+	}
+	if operations := Operations(); !reflect.DeepEqual(operations, expected) {
+		t.Errorf("Operations func returned wrong operations: got %#v want %#v", operations, expected)
+	}
+
+	Disable()
+	fs.Remove("/home/.vimrc")
+	if exists, _ := afero.Exists(memFs, "/home/.vimrc"); exists {
+		t.Errorf("Fs didn't remove /home/.vimrc with the dry run off")
+	}
+}
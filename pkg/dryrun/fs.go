@@ -0,0 +1,142 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dryrun
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Fs is an afero.Fs recording its changes in dry run instead of performing
+// them. Reads go through the wrapped Fs; files opened for writing discard
+// what's written to them.
+type Fs struct {
+	afero.Fs
+}
+
+// NewFs returns fs with its changes recorded in dry run.
+func NewFs(fs afero.Fs) *Fs {
+	return &Fs{Fs: fs}
+}
+
+// Create records the write of name.
+func (fs *Fs) Create(name string) (afero.File, error) {
+	if Record("write", "%s", name) {
+		return afero.NewMemMapFs().Create(name)
+	}
+	return fs.Fs.Create(name)
+}
+
+// OpenFile records the write of name if opened for writing.
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 && Record("write", "%s", name) {
+		return afero.NewMemMapFs().OpenFile(name, flag|os.O_CREATE, perm)
+	}
+	return fs.Fs.OpenFile(name, flag, perm)
+}
+
+// Mkdir records the creation of the name directory.
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	if Record("mkdir", "%s", name) {
+		return nil
+	}
+	return fs.Fs.Mkdir(name, perm)
+}
+
+// MkdirAll records the creation of the path directory.
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	if Record("mkdir", "%s", path) {
+		return nil
+	}
+	return fs.Fs.MkdirAll(path, perm)
+}
+
+// Remove records the removal of name.
+func (fs *Fs) Remove(name string) error {
+	if Record("remove", "%s", name) {
+		return nil
+	}
+	return fs.Fs.Remove(name)
+}
+
+// RemoveAll records the removal of path.
+func (fs *Fs) RemoveAll(path string) error {
+	if Record("remove", "%s", path) {
+		return nil
+	}
+	return fs.Fs.RemoveAll(path)
+}
+
+// Rename records the move of oldname to newname.
+func (fs *Fs) Rename(oldname string, newname string) error {
+	if Record("move", "%s to %s", oldname, newname) {
+		return nil
+	}
+	return fs.Fs.Rename(oldname, newname)
+}
+
+// Chmod records the change of the mode of name.
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	if Record("chmod", "%s %s", mode, name) {
+		return nil
+	}
+	return fs.Fs.Chmod(name, mode)
+}
+
+// Chown records the change of the owner of name.
+func (fs *Fs) Chown(name string, uid int, gid int) error {
+	if Record("chown", "%d:%d %s", uid, gid, name) {
+		return nil
+	}
+	return fs.Fs.Chown(name, uid, gid)
+}
+
+// Chtimes records the change of the times of name.
+func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if Record("chtimes", "%s", name) {
+		return nil
+	}
+	return fs.Fs.Chtimes(name, atime, mtime)
+}
+
+// SymlinkIfPossible records the creation of the newname symlink.
+func (fs *Fs) SymlinkIfPossible(oldname string, newname string) error {
+	if Record("symlink", "%s -> %s", newname, oldname) {
+		return nil
+	}
+	if linker, ok := fs.Fs.(afero.Linker); ok {
+		return linker.SymlinkIfPossible(oldname, newname)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: afero.ErrNoSymlink}
+}
+
+// LstatIfPossible calls the LstatIfPossible of the wrapped Fs, if any.
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lstater, ok := fs.Fs.(afero.Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := fs.Fs.Stat(name)
+	return fi, false, err
+}
+
+// ReadlinkIfPossible calls the ReadlinkIfPossible of the wrapped Fs, if any.
+func (fs *Fs) ReadlinkIfPossible(name string) (string, error) {
+	if reader, ok := fs.Fs.(afero.LinkReader); ok {
+		return reader.ReadlinkIfPossible(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: afero.ErrNoReadlink}
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/log"
+	pm "github.com/thylong/ian/pkg/package-managers"
+)
+
+// Capture returns, for the given package managers or every installed one,
+// the packages installed on purpose that aren't declared in env.yml yet.
+// With includeDeclared, declared packages are returned too.
+func Capture(packageManagers []string, includeDeclared bool) (map[string][]string, error) {
+	if len(packageManagers) == 0 {
+		for name, packageManager := range pm.SupportedPackageManagers {
+			if packageManager.IsInstalled() {
+				packageManagers = append(packageManagers, name)
+			}
+		}
+	}
+	for _, name := range packageManagers {
+		if !pm.IsSupportedPackageManager(name) {
+			return nil, fmt.Errorf("%s: %w", name, ErrUnsupportedPackageManager)
+		}
+	}
+
+	captured := make(map[string][]string)
+	for _, name := range packageManagers {
+		packages, err := pm.GetPackageManager(name).ListUserInstalled()
+		if err != nil {
+			log.Warningf("Skipping %s: %s\n", name, err)
+			continue
+		}
+		if !includeDeclared {
+			declared, err := GetDeclaredPackages(name)
+			if err != nil {
+				return nil, err
+			}
+			packages = DiffPackages(name, declared, nil, packages).Undeclared
+		}
+		if len(packages) > 0 {
+			sort.Strings(packages)
+			captured[name] = packages
+		}
+	}
+	return captured, nil
+}
+
+// SelectPackages asks, for every package manager, which of the captured
+// packages to keep: all of them, none or some selected one by one.
+func SelectPackages(captured map[string][]string, ask func(question string) string) map[string][]string {
+	selected := make(map[string][]string)
+	for _, name := range sortedKeys(captured) {
+		packages := captured[name]
+		question := fmt.Sprintf("%s: %s\nAdd these %d packages to env.yml? ([a]ll/[n]one/[s]elect)", name, strings.Join(packages, ", "), len(packages))
+		switch strings.ToLower(ask(question)) {
+		case "a", "all":
+			selected[name] = packages
+		case "s", "select":
+			for _, packageName := range packages {
+				if in := strings.ToLower(ask(fmt.Sprintf("Add %s %s? (y/N)", name, packageName))); in == "y" || in == "yes" {
+					selected[name] = append(selected[name], packageName)
+				}
+			}
+		}
+	}
+	return selected
+}
+
+// SavePackagesToEnvFile merges the packages into env.yml. With replace, the
+// packages of the given package managers replace the declared ones instead.
+func SavePackagesToEnvFile(packages map[string][]string, replace bool) error {
+	for name, packageNames := range packages {
+		if !replace {
+			declared, err := GetDeclaredPackages(name)
+			if err != nil {
+				return err
+			}
+			packageNames = mergePackages(declared, packageNames)
+		}
+		config.Vipers["env"].Set(name, packageNames)
+	}
+	config.UpdateYamlFile(config.ConfigFilesPathes["env"], config.Vipers["env"].AllSettings())
+	return nil
+}
+
+// mergePackages appends to declared the packages it doesn't contain yet,
+// whatever their version.
+func mergePackages(declared []string, packages []string) []string {
+	merged := append([]string{}, declared...)
+	seen := make(map[string]bool)
+	for _, name := range declared {
+		seen[strings.ToLower(packageName(name))] = true
+	}
+	for _, name := range packages {
+		if !seen[strings.ToLower(packageName(name))] {
+			seen[strings.ToLower(packageName(name))] = true
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
+
+// sortedKeys returns the sorted keys of m.
+func sortedKeys[V any](m map[string]V) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,45 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectPackages(t *testing.T) {
+	captured := map[string][]string{
+		"brew": {"git", "jq", "wget"},
+		"npm":  {"typescript"},
+		"pip":  {"black"},
+	}
+	answers := map[string]string{
+		"brew: git, jq, wget\nAdd these 3 packages to env.yml? ([a]ll/[n]one/[s]elect)": "s",
+		"Add brew git? (y/N)":  "y",
+		"Add brew jq? (y/N)":   "",
+		"Add brew wget? (y/N)": "yes",
+		"npm: typescript\nAdd these 1 packages to env.yml? ([a]ll/[n]one/[s]elect)": "a",
+		"pip: black\nAdd these 1 packages to env.yml? ([a]ll/[n]one/[s]elect)":      "n",
+	}
+	selected := SelectPackages(captured, func(question string) string {
+		answer, ok := answers[question]
+		if !ok {
+			t.Fatalf("SelectPackages func asked an unexpected question: %q", question)
+		}
+		return answer
+	})
+	expected := map[string][]string{"brew": {"git", "wget"}, "npm": {"typescript"}}
+	if !reflect.DeepEqual(selected, expected) {
+		t.Errorf("SelectPackages func returned wrong packages: got %#v want %#v", selected, expected)
+	}
+}
+
+func TestMergePackages(t *testing.T) {
+	merged := mergePackages([]string{"git", "Wget"}, []string{"wget", "jq", "jq"})
+	if expected := []string{"git", "Wget", "jq"}; !reflect.DeepEqual(merged, expected) {
+		t.Errorf("mergePackages func returned wrong packages: got %#v want %#v", merged, expected)
+	}
+
+	merged = mergePackages([]string{"node@20"}, []string{"node", "jq"})
+	if expected := []string{"node@20", "jq"}; !reflect.DeepEqual(merged, expected) {
+		t.Errorf("mergePackages func returned wrong packages with versions: got %#v want %#v", merged, expected)
+	}
+}
@@ -19,6 +19,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+	"github.com/thylong/ian/pkg/dryrun"
 )
 
 // ErrCannotStatFile occurs when stating a non-existing file
@@ -81,10 +85,100 @@ func copyFileContents(src, dst string) (err error) {
 	return out.Sync()
 }
 
-// MoveFile copies given src to dst and remove dst.
+// CopyDir recursively copies the directory src to dst, merging its content
+// with dst if it already exists. Files are copied with CopyFile and symlinks
+// as symlinks.
+func CopyDir(src, dst string) (err error) {
+	return copyDir(src, dst, CopyFile)
+}
+
+// copyDir recursively copies the directory src to dst, files being copied
+// with copyFile.
+func copyDir(src, dst string, copyFile func(src, dst string) error) (err error) {
+	sfi, err := AppFs.Stat(src)
+	if err != nil {
+		return ErrCannotStatFile
+	}
+	if !sfi.IsDir() {
+		return fmt.Errorf("CopyDir: source %s is not a directory", sfi.Name())
+	}
+	return afero.Walk(AppFs, src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return AppFs.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			return copySymlink(path, target)
+		default:
+			return copyFile(path, target)
+		}
+	})
+}
+
+// copySymlink creates at dst a symlink with the same target as src.
+func copySymlink(src, dst string) (err error) {
+	reader, ok := AppFs.(afero.LinkReader)
+	linker, ok2 := AppFs.(afero.Linker)
+	if !ok || !ok2 {
+		return fmt.Errorf("copySymlink: symlinks are not supported")
+	}
+	target, err := reader.ReadlinkIfPossible(src)
+	if err != nil {
+		return err
+	}
+	AppFs.Remove(dst)
+	return linker.SymlinkIfPossible(target, dst)
+}
+
+// copyFileWithMode copies the contents and permissions of the file named src
+// to the file named dst, without ever hard linking them.
+func copyFileWithMode(src, dst string) (err error) {
+	sfi, err := AppFs.Stat(src)
+	if err != nil {
+		return ErrCannotStatFile
+	}
+	if err = copyFileContents(src, dst); err != nil {
+		return err
+	}
+	return AppFs.Chmod(dst, sfi.Mode().Perm())
+}
+
+// MoveFile copies given src to dst and remove src.
+// Directories are copied recursively and symlinks as symlinks. If the copy
+// fails, the partial copy is removed, unless dst already existed. If src
+// can't be removed, the error matches ErrCannotRemoveMovedFile.
 func MoveFile(src, dst string) (err error) {
-	if err := CopyFile(src, dst); err != nil {
+	fi, err := lstat(src)
+	if err != nil {
+		return ErrCannotStatFile
+	}
+	if dryrun.Record("move", "%s to %s", src, dst) {
+		return nil
+	}
+	_, dstErr := lstat(dst)
+	switch {
+	case fi.IsDir():
+		err = CopyDir(src, dst)
+	case fi.Mode()&os.ModeSymlink != 0:
+		err = copySymlink(src, dst)
+	default:
+		err = CopyFile(src, dst)
+	}
+	if err != nil {
+		if os.IsNotExist(dstErr) {
+			AppFs.RemoveAll(dst)
+		}
 		return err
 	}
-	return AppFs.Remove(src)
+	if err = AppFs.RemoveAll(src); err != nil {
+		return fmt.Errorf("%w %s: %v", ErrCannotRemoveMovedFile, src, err)
+	}
+	return nil
 }
@@ -1,6 +1,10 @@
 package env
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -43,3 +47,51 @@ func TestCopyFile(t *testing.T) {
 		AppFs.Remove(tc.DstPath)
 	}
 }
+
+func TestCopyDir(t *testing.T) {
+	AppFs = afero.NewMemMapFs()
+	defer func() { AppFs = afero.NewOsFs() }()
+
+	afero.WriteFile(AppFs, "/src/init.lua", []byte("test"), 0644)
+	afero.WriteFile(AppFs, "/src/lua/plugins.lua", []byte("plugins"), 0644)
+	afero.WriteFile(AppFs, "/dst/existing.lua", []byte("existing"), 0644)
+
+	if err := CopyDir("/src", "/dst"); err != nil {
+		t.Fatalf("CopyDir func returned an error: %s", err)
+	}
+	for path, expected := range map[string]string{
+		"/dst/init.lua":        "test",
+		"/dst/lua/plugins.lua": "plugins",
+		"/dst/existing.lua":    "existing",
+		"/src/lua/plugins.lua": "plugins",
+	} {
+		if content, err := afero.ReadFile(AppFs, path); err != nil || string(content) != expected {
+			t.Errorf("CopyDir func returned wrong content for %s: got %q want %q", path, content, expected)
+		}
+	}
+
+	if err := CopyDir("/missing", "/dst"); err != ErrCannotStatFile {
+		t.Errorf("CopyDir func returned wrong error: got %#v want %#v", err, ErrCannotStatFile)
+	}
+}
+
+func TestMoveFileRemovesPartialCopy(t *testing.T) {
+	src := filepath.Join(t.TempDir(), ".config")
+	dst := filepath.Join(t.TempDir(), ".config")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(src, "a.yml"), []byte("test"), 0644)
+	// Named pipes can't be copied.
+	if err := syscall.Mkfifo(filepath.Join(src, "b.pipe"), 0644); err != nil {
+		t.Skipf("cannot create a named pipe: %s", err)
+	}
+
+	if err := MoveFile(src, dst); err == nil || errors.Is(err, ErrCannotRemoveMovedFile) {
+		t.Fatalf("MoveFile func returned wrong error: got %#v", err)
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("MoveFile func didn't remove the partial copy")
+	}
+	if _, err := os.Stat(filepath.Join(src, "a.yml")); err != nil {
+		t.Errorf("MoveFile func removed src: %s", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/thylong/ian/pkg/config"
+	pm "github.com/thylong/ian/pkg/package-managers"
+)
+
+// PackagesDiff is the drift between the packages declared in env.yml for a
+// package manager and the ones it installed.
+type PackagesDiff struct {
+	PackageManager string `json:"package_manager"`
+	// Missing contains the packages declared but not installed.
+	Missing []string `json:"missing"`
+	// Undeclared contains the packages installed on purpose but not declared.
+	Undeclared []string `json:"undeclared"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// HasDrift returns true if the installed packages don't match env.yml.
+func (diff PackagesDiff) HasDrift() bool {
+	return len(diff.Missing) > 0 || len(diff.Undeclared) > 0 || diff.Error != ""
+}
+
+// Diff compares the packages declared in env.yml with the installed ones for
+// the given package managers, or every package manager of env.yml.
+func Diff(packageManagers []string) (diffs []PackagesDiff, err error) {
+	if len(packageManagers) == 0 {
+		packageManagers = config.Vipers["env"].AllKeys()
+		sort.Strings(packageManagers)
+	}
+	for _, name := range packageManagers {
+		if !pm.IsSupportedPackageManager(name) {
+			return nil, fmt.Errorf("%s: %w", name, ErrUnsupportedPackageManager)
+		}
+	}
+
+	for _, name := range packageManagers {
+		declared, err := GetDeclaredPackages(name)
+		if err != nil {
+			diffs = append(diffs, PackagesDiff{PackageManager: name, Error: err.Error()})
+			continue
+		}
+		packageManager := pm.GetPackageManager(name)
+		if !packageManager.IsInstalled() {
+			diffs = append(diffs, PackagesDiff{PackageManager: name, Missing: declared, Error: fmt.Sprintf("%s is not installed", name)})
+			continue
+		}
+		installed, err := packageManager.ListInstalled()
+		if err != nil {
+			diffs = append(diffs, PackagesDiff{PackageManager: name, Error: err.Error()})
+			continue
+		}
+		userInstalled, err := packageManager.ListUserInstalled()
+		if err != nil {
+			diffs = append(diffs, PackagesDiff{PackageManager: name, Error: err.Error()})
+			continue
+		}
+		diffs = append(diffs, DiffPackages(name, declared, installed, userInstalled))
+	}
+	return diffs, nil
+}
+
+// DiffPackages returns the drift between the declared and the installed
+// packages of a package manager. Packages installed as dependencies aren't
+// reported as undeclared, hence userInstalled, the packages installed on
+// purpose. Names are compared case-insensitively, see installedName.
+func DiffPackages(packageManager string, declared []string, installed []string, userInstalled []string) PackagesDiff {
+	diff := PackagesDiff{PackageManager: packageManager, Missing: []string{}, Undeclared: []string{}}
+	declaredSet := make(map[string]bool)
+	for _, name := range declared {
+		declaredSet[strings.ToLower(name)] = true
+		declaredSet[strings.ToLower(packageName(name))] = true
+	}
+	diff.Missing = append(diff.Missing, MissingPackages(packageManager, declared, installed)...)
+	for _, name := range userInstalled {
+		if !declaredSet[strings.ToLower(name)] {
+			diff.Undeclared = append(diff.Undeclared, name)
+		}
+	}
+	sort.Strings(diff.Undeclared)
+	return diff
+}
+
+// HasDrift returns true if one of the diffs has drifted.
+func HasDrift(diffs []PackagesDiff) bool {
+	for _, diff := range diffs {
+		if diff.HasDrift() {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintDiff writes the diffs, missing packages being prefixed by "-" and
+// undeclared ones by "+", followed by a summary.
+func PrintDiff(w io.Writer, diffs []PackagesDiff) {
+	var missing, undeclared int
+	for _, diff := range diffs {
+		missing += len(diff.Missing)
+		undeclared += len(diff.Undeclared)
+		if !diff.HasDrift() {
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", diff.PackageManager)
+		if diff.Error != "" {
+			fmt.Fprintf(w, "  ! %s\n", diff.Error)
+		}
+		for _, name := range diff.Missing {
+			fmt.Fprintf(w, "  - %s\n", name)
+		}
+		for _, name := range diff.Undeclared {
+			fmt.Fprintf(w, "  + %s\n", name)
+		}
+	}
+	if !HasDrift(diffs) {
+		fmt.Fprintln(w, "Installed packages match env.yml.")
+		return
+	}
+	fmt.Fprintf(w, "\n%d missing (-), %d undeclared (+)\n", missing, undeclared)
+}
+
+// PrintDiffJSON writes the diffs as JSON.
+func PrintDiffJSON(w io.Writer, diffs []PackagesDiff) error {
+	if diffs == nil {
+		diffs = []PackagesDiff{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diffs)
+}
@@ -0,0 +1,88 @@
+package env
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/thylong/ian/pkg/config"
+)
+
+// setEnvPackages replaces the packages of env.yml until the end of the test.
+func setEnvPackages(t *testing.T, packages map[string][]interface{}) {
+	previous := config.Vipers["env"]
+	t.Cleanup(func() { config.Vipers["env"] = previous })
+	config.Vipers["env"] = viper.New()
+	for name, list := range packages {
+		config.Vipers["env"].Set(name, list)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	setEnvPackages(t, map[string][]interface{}{"brew": {"git", "htop"}})
+	brew := registerFakePackageManager(t, "brew")
+	brew.installed = []string{"git", "jq", "pcre2"}
+	// Dependencies (pcre2) aren't installed on purpose, so they're not undeclared.
+	brew.userInstalled = []string{"git", "jq"}
+
+	diffs, err := Diff(nil)
+	expected := []PackagesDiff{{PackageManager: "brew", Missing: []string{"htop"}, Undeclared: []string{"jq"}}}
+	if err != nil || !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("Diff func returned wrong diffs: got (%#v, %v) want %#v", diffs, err, expected)
+	}
+}
+
+func TestDiffPackages(t *testing.T) {
+	diff := DiffPackages("brew", []string{"git", "Wget", "htop"}, []string{"wget", "git", "jq", "pcre2"}, []string{"wget", "git", "jq"})
+	expected := PackagesDiff{PackageManager: "brew", Missing: []string{"htop"}, Undeclared: []string{"jq"}}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("DiffPackages func returned wrong diff: got %#v want %#v", diff, expected)
+	}
+	if !diff.HasDrift() {
+		t.Errorf("HasDrift func returned false with missing packages")
+	}
+
+	diff = DiffPackages("brew", []string{"git"}, []string{"git", "pcre2"}, []string{"git"})
+	if diff.HasDrift() {
+		t.Errorf("HasDrift func returned true without drift: %#v", diff)
+	}
+
+	diff = DiffPackages("brew", []string{"node@20"}, []string{"node@20"}, []string{"node@20"})
+	if diff.HasDrift() {
+		t.Errorf("HasDrift func returned true for an installed versioned formula: %#v", diff)
+	}
+
+	diff = DiffPackages("pip", []string{"requests>=2,<3", "black@23.1"}, []string{"requests"}, []string{"requests"})
+	expected = PackagesDiff{PackageManager: "pip", Missing: []string{"black@23.1"}, Undeclared: []string{}}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("DiffPackages func returned wrong diff with versions: got %#v want %#v", diff, expected)
+	}
+}
+
+func TestPrintDiff(t *testing.T) {
+	cases := []struct {
+		Diffs    []PackagesDiff
+		Expected string
+	}{
+		{
+			[]PackagesDiff{{PackageManager: "brew"}},
+			"Installed packages match env.yml.\n",
+		},
+		{
+			[]PackagesDiff{
+				{PackageManager: "brew", Missing: []string{"htop"}, Undeclared: []string{"jq"}},
+				{PackageManager: "npm"},
+				{PackageManager: "pip", Missing: []string{"black"}, Error: "pip is not installed"},
+			},
+			"brew:\n  - htop\n  + jq\npip:\n  ! pip is not installed\n  - black\n\n2 missing (-), 1 undeclared (+)\n",
+		},
+	}
+	for _, tc := range cases {
+		var buf bytes.Buffer
+		PrintDiff(&buf, tc.Diffs)
+		if buf.String() != tc.Expected {
+			t.Errorf("PrintDiff func returned wrong output: got %q want %q", buf.String(), tc.Expected)
+		}
+	}
+}
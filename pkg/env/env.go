@@ -16,8 +16,7 @@ package env
 
 import (
 	"errors"
-	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
@@ -25,10 +24,13 @@ import (
 	"path/filepath"
 	"strings"
 
+	git "github.com/go-git/go-git/v5"
 	"github.com/spf13/afero"
-	"github.com/thylong/ian/pkg/command"
 	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
 	"github.com/thylong/ian/pkg/log"
+	pm "github.com/thylong/ian/pkg/package-managers"
+	"github.com/thylong/ian/pkg/repo"
 )
 
 // AppFs is a wrapper to OS package
@@ -36,6 +38,14 @@ var AppFs = afero.NewOsFs()
 
 var httpGet = http.Get
 
+// EnableDryRun records the changes to the filesystem and the dotfiles
+// repository instead of making them, printing them to out.
+func EnableDryRun(out io.Writer) {
+	dryrun.Enable(out)
+	AppFs = dryrun.NewFs(AppFs)
+	Git = &DryRunGitClient{GitClient: Git}
+}
+
 var execCommand = exec.Command
 
 // IPCheckerURL is the endpoint to call to get IP data
@@ -52,121 +62,386 @@ func Remove(packageManager string, packages []string) (NewPMList []string, err e
 }
 
 // Save persists the dotfiles in distant repository.
-func Save(dotfilesToSave []string) (err error) {
+// See ImportIntoDotfilesDir for dotfilesToSave and PersistDotfiles for force.
+// With resume, the import interrupted in a previous run is completed instead.
+func Save(dotfilesToSave []string, force bool, resume bool) (err error) {
 	if err = EnsureDotfilesDir(config.DotfilesDirPath); err != nil {
 		return err
 	}
-	if err = ImportIntoDotfilesDir(dotfilesToSave, config.DotfilesDirPath); err != nil {
+	if resume {
+		err = ResumeImport()
+	} else {
+		err = importDotfiles(dotfilesToSave)
+	}
+	if err != nil {
 		return err
 	}
 	if err = EnsureDotfilesRepository(config.GetDotfilesRepositoryPath(), config.DotfilesDirPath); err != nil {
 		return err
 	}
-	if err = PersistDotfiles(config.GetDefaultSaveMessage(), config.DotfilesDirPath); err != nil {
+	if err = PersistDotfiles(config.GetDefaultSaveMessage(), config.DotfilesDirPath, force); err != nil {
 		return err
 	}
 	return nil
 }
 
-// EnsureDotfilesDir create the ~/.dotfiles directory if not exists.
+// importDotfiles imports the dotfiles, unless a previous import has been
+// interrupted.
+func importDotfiles(dotfilesToSave []string) error {
+	if journal, err := LoadJournal(ImportJournalPath); err != nil || journal != nil {
+		return ErrInterruptedImport
+	}
+	mode, err := GetLinkMode()
+	if err != nil {
+		return err
+	}
+	return ImportIntoDotfilesDir(dotfilesToSave, config.DotfilesDirPath, GetDotfilesRules(), mode)
+}
+
+// Pull updates the dotfiles directory from the dotfiles repository, links the
+// new dotfiles into the home directory and returns the dotfiles that have been
+// removed from the repository but are still linked.
+// See GetConflictStrategy for conflict.
+func Pull(dotfilesDirPath string, conflict string) (report LinkReport, dangling []string, err error) {
+	if _, err := AppFs.Stat(dotfilesDirPath); err != nil {
+		return report, nil, ErrDotfilesDirNotFound
+	}
+	if err = Git.Fetch(dotfilesDirPath, "origin"); err != nil {
+		return report, nil, err
+	}
+	if err = Git.Rebase(dotfilesDirPath, "origin", config.GetDotfilesBranch()); err != nil {
+		if errors.Is(err, git.ErrWorktreeNotClean) {
+			return report, nil, ErrUncommittedDotfiles
+		}
+		return report, nil, err
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return report, nil, err
+	}
+	opts, err := GetLinkOptions(conflict)
+	if err != nil {
+		return report, nil, err
+	}
+	if report, err = LinkDotfiles(dotfilesDirPath, usr.HomeDir, opts); err != nil {
+		return report, nil, err
+	}
+	dangling, err = FindDanglingDotfiles(dotfilesDirPath, usr.HomeDir)
+	return report, dangling, err
+}
+
+// Unlink replaces the given dotfiles, or every dotfile with all, by a copy of
+// their version of the dotfiles directory. With remove, they are moved out
+// of the dotfiles directory instead, to stop tracking them.
+func Unlink(dotfilesToUnlink []string, all bool, remove bool) (unlinked []string, err error) {
+	usr, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case all:
+		dotfilesToUnlink = []string{""}
+	case len(dotfilesToUnlink) == 0:
+		return nil, ErrNoDotfileToUnlink
+	default:
+		for i, dotfileToUnlink := range dotfilesToUnlink {
+			if dotfilesToUnlink[i], err = GetDotfileRelativePath(dotfileToUnlink, usr.HomeDir); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return UnlinkDotfiles(dotfilesToUnlink, config.DotfilesDirPath, usr.HomeDir, remove)
+}
+
+// EnsureDotfilesDir create the ~/.dotfiles directory and its git repository if not exists.
 func EnsureDotfilesDir(dotfilesDirPath string) (err error) {
-	dotfilesDirPath = filepath.Dir(dotfilesDirPath)
 	if _, err := AppFs.Stat(dotfilesDirPath); err != nil {
-		err = AppFs.Mkdir(dotfilesDirPath, 0766)
+		err = AppFs.MkdirAll(dotfilesDirPath, 0766)
 		if err != nil {
 			return ErrOperationNotPermitted
 		}
-		command.ExecuteCommand(execCommand("git", "init"))
+		if err = Git.Init(dotfilesDirPath, config.GetDotfilesBranch()); err != nil {
+			return err
+		}
 		GitIgnorePath := filepath.Join(dotfilesDirPath, ".gitignore")
-		ioutil.WriteFile(GitIgnorePath, []byte(".ssh\n.netrc"), 0766)
+		afero.WriteFile(AppFs, GitIgnorePath, []byte(".ssh\n.netrc"), 0766)
 	}
 	return nil
 }
 
 // ImportIntoDotfilesDir moves dotfiles into dotfiles directory and create symlinks.
-func ImportIntoDotfilesDir(dotfilesToSave []string, dotfilesDirPath string) (err error) {
+// Without dotfilesToSave, every dotfile of the home directory matched by rules
+// is imported. Otherwise, only the given paths are, provided they aren't
+// excluded by rules. Nested paths keep their structure in the dotfiles
+// directory, and directories are linked as a whole or file by file depending
+// on mode. The import is recorded in a Journal and rolled back on failure.
+func ImportIntoDotfilesDir(dotfilesToSave []string, dotfilesDirPath string, rules DotfilesRules, mode LinkMode) (err error) {
 	usr, _ := user.Current()
 
-	if len(dotfilesToSave) == 0 {
-		files, _ := ioutil.ReadDir(usr.HomeDir)
+	explicit := len(dotfilesToSave) > 0
+	if !explicit {
+		files, _ := afero.ReadDir(AppFs, usr.HomeDir)
 		for _, file := range files {
-			if strings.HasPrefix(file.Name(), ".") && file.Name() != ".ssh" && file.Name() != ".bash_history" && file.Name() != ".Trash" {
+			if strings.HasPrefix(file.Name(), ".") {
 				dotfilesToSave = append(dotfilesToSave, file.Name())
 			}
 		}
+	} else {
+		for i, dotfileToSave := range dotfilesToSave {
+			if dotfilesToSave[i], err = GetDotfileRelativePath(dotfileToSave, usr.HomeDir); err != nil {
+				return err
+			}
+		}
+		rules = DotfilesRules{Includes: dotfilesToSave, Excludes: rules.Excludes}
 	}
+
+	journalDir, _ := filepath.Rel(usr.HomeDir, filepath.Dir(ImportJournalPath))
+	importer := dotfilesImporter{homeDir: usr.HomeDir, dotfilesDirPath: dotfilesDirPath, journalDir: journalDir, rules: rules, mode: mode}
 	for _, dotfileToSave := range dotfilesToSave {
+		if err = importer.plan(dotfileToSave); err != nil {
+			return err
+		}
+	}
+	if explicit {
+		for _, dotfile := range importer.excluded {
+			log.Warningf("Skipping %s: excluded by dotfiles.exclude\n", dotfile)
+		}
+	}
+	var srcs, dsts []string
+	for _, dotfileToSave := range importer.paths {
 		src := filepath.Join(usr.HomeDir, dotfileToSave)
 		dst := filepath.Join(dotfilesDirPath, dotfileToSave)
 
-		if err := MoveFile(src, dst); err != nil {
+		if err := AppFs.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 			return ErrCannotMoveDotfile
 		}
-		if err := os.Symlink(dst, src); err != nil {
-			return ErrCannotSymlink
-		}
+		srcs = append(srcs, src)
+		dsts = append(dsts, dst)
+	}
+	if err = NewJournal(ImportJournalPath, srcs, dsts).Run(); err != nil {
+		return err
 	}
 	log.Infof("Moved dotfiles in %s directory\n", dotfilesDirPath)
 	return nil
 }
 
-// EnsureDotfilesRepository create Dotfiles repository if not exists.
+// ResumeImport completes the dotfiles import interrupted in a previous run.
+func ResumeImport() error {
+	journal, err := LoadJournal(ImportJournalPath)
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		return ErrNoInterruptedImport
+	}
+	return journal.Run()
+}
+
+// RollbackImport restores the dotfiles moved by the import interrupted in a
+// previous run.
+func RollbackImport() error {
+	journal, err := LoadJournal(ImportJournalPath)
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		return ErrNoInterruptedImport
+	}
+	return journal.Rollback()
+}
+
+var errExcludedFound = errors.New("excluded file found")
+
+// dotfilesImporter lists the paths, relative to the home directory, to move
+// into the dotfiles directory and to replace by a symlink. The directory of
+// the import journal is never moved, even listed by name.
+type dotfilesImporter struct {
+	homeDir         string
+	dotfilesDirPath string
+	journalDir      string
+	rules           DotfilesRules
+	mode            LinkMode
+
+	paths    []string
+	excluded []string
+}
+
+// plan adds path, or its content if it's a directory that can't be linked as
+// a whole, to the paths to import.
+func (i *dotfilesImporter) plan(path string) error {
+	src := filepath.Join(i.homeDir, path)
+	if isLinkedDotfile(src, filepath.Join(i.dotfilesDirPath, path)) {
+		return nil
+	}
+	fi, err := lstat(src)
+	if err != nil {
+		return ErrCannotMoveDotfile
+	}
+
+	matched := i.rules.Match(path) && path != i.journalDir
+	if !fi.IsDir() {
+		if matched {
+			i.paths = append(i.paths, path)
+		} else {
+			i.excluded = append(i.excluded, path)
+		}
+		return nil
+	}
+	if path == i.journalDir || (!matched && !i.rules.HasIncludesUnder(path)) {
+		i.excluded = append(i.excluded, path)
+		return nil
+	}
+	if matched && i.mode == LinkDirectory && !i.containsExcluded(path) && !strings.HasPrefix(i.journalDir, path+string(filepath.Separator)) {
+		i.paths = append(i.paths, path)
+		return nil
+	}
+
+	files, err := afero.ReadDir(AppFs, src)
+	if err != nil {
+		return ErrCannotMoveDotfile
+	}
+	for _, file := range files {
+		if err := i.plan(filepath.Join(path, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsExcluded returns whether the directory at path contains files
+// excluded by the rules.
+func (i *dotfilesImporter) containsExcluded(path string) bool {
+	err := afero.Walk(AppFs, filepath.Join(i.homeDir, path), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(i.homeDir, p); err == nil && !i.rules.Match(rel) {
+			return errExcludedFound
+		}
+		return nil
+	})
+	return err == errExcludedFound
+}
+
+// GetDotfileRelativePath returns the path of a dotfile relative to homeDir.
+// Relative paths are considered relative to homeDir.
+func GetDotfileRelativePath(path string, homeDir string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = filepath.Join(homeDir, path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(homeDir, path)
+	}
+	rel, err := filepath.Rel(homeDir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidDotfilePath
+	}
+	return rel, nil
+}
+
+// GetDotfilesRules returns the dotfiles rules set in config.yml.
+func GetDotfilesRules() DotfilesRules {
+	return DotfilesRules{
+		Includes: config.GetDotfilesIncludes(),
+		Excludes: config.GetDotfilesExcludes(),
+	}
+}
+
+// lstat returns the FileInfo of path without following symlinks, if AppFs
+// supports it.
+func lstat(path string) (os.FileInfo, error) {
+	if lstater, ok := AppFs.(afero.Lstater); ok {
+		fi, _, err := lstater.LstatIfPossible(path)
+		return fi, err
+	}
+	return AppFs.Stat(path)
+}
+
+// isLinkedDotfile returns whether src is already a symlink to dst.
+func isLinkedDotfile(src string, dst string) bool {
+	linker, ok := AppFs.(afero.LinkReader)
+	if !ok {
+		return false
+	}
+	target, err := linker.ReadlinkIfPossible(src)
+	return err == nil && target == dst
+}
+
+// EnsureDotfilesRepository checks the dotfiles repository is reachable and
+// sets it as origin of the dotfiles directory.
 func EnsureDotfilesRepository(dotfilesRepository string, dotfilesDirPath string) (err error) {
 	if dotfilesRepository == "" {
 		dotfilesRepository = config.GetDotfilesRepository()
 	}
 
-	repositoryURL := fmt.Sprintf("git@github.com:%s.git", dotfilesRepository)
-	lsRemoteCmd := execCommand("git", "ls-remote", repositoryURL)
-	lsRemoteCmd.Dir = dotfilesDirPath
+	remote, err := GetDotfilesRemote(dotfilesRepository)
+	if err != nil {
+		log.Errorln(err)
+		return ErrDotfilesRepository
+	}
+	repositoryURL := remote.SSHURL()
 
-	if err := command.MustExecuteCommand(lsRemoteCmd); err != nil {
+	if err := Git.LsRemote(repositoryURL); err != nil {
 		log.Errorln(err)
 		return ErrDotfilesRepository
 	}
-	return nil
+	return Git.SetRemote(dotfilesDirPath, "origin", repositoryURL)
+}
+
+// GetDotfilesRemote returns the Remote of the dotfiles repository, resolving
+// shorthands with the dotfiles provider and host from config.yml.
+func GetDotfilesRemote(dotfilesRepository string) (repo.Remote, error) {
+	return repo.ParseRemote(dotfilesRepository, config.GetDotfilesProvider(), config.GetDotfilesHost())
 }
 
 // PersistDotfiles local dotfiles to remote.
-func PersistDotfiles(message string, dotfilesDirPath string) (err error) {
+// Local commits are rebased onto the remote branch before pushing, unless
+// force is set, in which case the remote branch is overwritten.
+func PersistDotfiles(message string, dotfilesDirPath string, force bool) (err error) {
 	if len(message) == 0 {
 		message = "Update dotfiles"
 	}
+	branch := config.GetDotfilesBranch()
 
-	addCmd := execCommand("git", "add", "-A")
-	addCmd.Dir = dotfilesDirPath
-	if err = command.MustExecuteCommand(addCmd); err != nil {
-		return ErrCannotInteractWithGit
+	if err = Git.AddAll(dotfilesDirPath); err != nil {
+		return err
 	}
 
-	commitCmd := execCommand("git", "commit", "-m", message)
-	commitCmd.Dir = dotfilesDirPath
-	if err = command.MustExecuteCommand(commitCmd); err != nil {
-		return errors.New("Cannot create a commit")
+	// Nothing new to commit, previous commits may still have to be pushed.
+	if err = Git.Commit(dotfilesDirPath, message); err != nil && err != ErrNothingToCommit {
+		return err
 	}
 
-	pushCmd := execCommand("git", "push", "--force", "origin", "master")
-	pushCmd.Dir = dotfilesDirPath
-	if err = command.MustExecuteCommand(pushCmd); err != nil {
-		return errors.New("Cannot push to repository")
+	if force {
+		log.Warningf("Overwriting the %s branch of the dotfiles repository\n", branch)
+		return Git.Push(dotfilesDirPath, "origin", branch, true)
 	}
-	return nil
+
+	if err = Git.Fetch(dotfilesDirPath, "origin"); err != nil {
+		return err
+	}
+	if err = Git.Rebase(dotfilesDirPath, "origin", branch); err != nil {
+		return err
+	}
+	return Git.Push(dotfilesDirPath, "origin", branch, false)
 }
 
-// AddPackagesToEnvFile adds packages to the env.yml file.
-func AddPackagesToEnvFile(packageManagerName string, packages []string) {
+// AddPackagesToEnvFile adds packages to the env.yml file. A package already
+// declared with another version is replaced.
+func AddPackagesToEnvFile(packageManagerName string, packages []string) error {
+	if errs := validatePackages(pm.GetPackageManager(packageManagerName), packages); len(errs) > 0 {
+		return errs[0]
+	}
 	envContent := config.Vipers["env"].AllSettings()
-	pmContent := config.Vipers["env"].GetStringSlice(packageManagerName)
-	contains := func(e []string, c string) bool {
-		for _, s := range e {
-			if s == c {
-				return true
-			}
-		}
-		return false
+	pmContent, err := GetDeclaredPackages(packageManagerName)
+	if err != nil {
+		return err
 	}
 	for _, p := range packages {
-		if !contains(pmContent, p) {
+		if i := indexOfPackage(pmContent, p); i != -1 {
+			pmContent[i] = p
+		} else {
 			pmContent = append(pmContent, p)
 		}
 	}
@@ -176,29 +451,39 @@ func AddPackagesToEnvFile(packageManagerName string, packages []string) {
 		config.ConfigFilesPathes["env"],
 		envContent,
 	)
+	return nil
 }
 
-// RemovePackagesFromEnvFile removes packages from the env.yml file.
-func RemovePackagesFromEnvFile(packageManagerName string, packages []string) {
+// RemovePackagesFromEnvFile removes packages, whatever their version, from
+// the env.yml file.
+func RemovePackagesFromEnvFile(packageManagerName string, packages []string) error {
 	envContent := config.Vipers["env"].AllSettings()
-	pmContent := config.Vipers["env"].GetStringSlice(packageManagerName)
-	contains := func(e []string, c string) bool {
-		for _, s := range e {
-			if s == c {
-				return true
-			}
-		}
-		return false
+	pmContent, err := GetDeclaredPackages(packageManagerName)
+	if err != nil {
+		return err
 	}
-	for i, p := range packages {
-		if contains(pmContent, p) {
-			pmContent = append(pmContent[:i], pmContent[i+1:]...)
+	kept := []string{}
+	for _, p := range pmContent {
+		if indexOfPackage(packages, p) == -1 {
+			kept = append(kept, p)
 		}
 	}
 
-	envContent[packageManagerName] = pmContent
+	envContent[packageManagerName] = kept
 	config.UpdateYamlFile(
 		config.ConfigFilesPathes["env"],
 		envContent,
 	)
+	return nil
+}
+
+// indexOfPackage returns the index in packages of the package with the same
+// name as entry, or -1.
+func indexOfPackage(packages []string, entry string) int {
+	for i, p := range packages {
+		if strings.EqualFold(packageName(p), packageName(entry)) {
+			return i
+		}
+	}
+	return -1
 }
@@ -5,6 +5,9 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -26,9 +29,47 @@ func mockExecCommand(command string, args ...string) *exec.Cmd {
 	return cmd
 }
 
+// fakeGitClient is a GitClient recording the operations without running them.
+type fakeGitClient struct {
+	Operations []string
+}
+
+func (client *fakeGitClient) record(operation string, args ...string) error {
+	client.Operations = append(client.Operations, strings.Join(append([]string{operation}, args...), " "))
+	return nil
+}
+
+func (client *fakeGitClient) Init(dir string, branch string) error {
+	return client.record("init", dir, branch)
+}
+func (client *fakeGitClient) Clone(url string, dir string) error {
+	return client.record("clone", url, dir)
+}
+func (client *fakeGitClient) SetRemote(dir string, name string, url string) error {
+	return client.record("remote", dir, name, url)
+}
+func (client *fakeGitClient) AddAll(dir string) error { return client.record("add", dir) }
+func (client *fakeGitClient) Commit(dir string, message string) error {
+	return client.record("commit", dir, message)
+}
+func (client *fakeGitClient) Fetch(dir string, remote string) error {
+	return client.record("fetch", dir, remote)
+}
+func (client *fakeGitClient) Rebase(dir string, remote string, branch string) error {
+	return client.record("rebase", dir, remote, branch)
+}
+func (client *fakeGitClient) Push(dir string, remote string, branch string, force bool) error {
+	return client.record("push", dir, remote, branch, fmt.Sprint(force))
+}
+func (client *fakeGitClient) LsRemote(url string) error { return client.record("ls-remote", url) }
+
 func TestEnsureDotfilesDir(t *testing.T) {
 	AppFs = afero.NewMemMapFs()
-	defer func() { AppFs = afero.NewOsFs() }()
+	Git = &fakeGitClient{}
+	defer func() {
+		AppFs = afero.NewOsFs()
+		Git = &GoGitClient{Progress: os.Stdout}
+	}()
 
 	cases := []struct {
 		DotfilesDirPath string
@@ -77,7 +118,7 @@ func TestImportIntoDotfilesDir(t *testing.T) {
 		if !tc.PermissionOk {
 			AppFs = afero.NewReadOnlyFs(AppFs)
 		}
-		if err := ImportIntoDotfilesDir(tc.DotfilesToSave, tc.DotfilesDirPath); err != tc.ExpectedErr {
+		if err := ImportIntoDotfilesDir(tc.DotfilesToSave, tc.DotfilesDirPath, DotfilesRules{}, LinkDirectory); err != tc.ExpectedErr {
 			t.Errorf("ImportIntoDotfilesDir func returned wrong err: got %#v want %#v",
 				err, tc.ExpectedErr)
 		}
@@ -85,6 +126,74 @@ func TestImportIntoDotfilesDir(t *testing.T) {
 	}
 }
 
+func TestDotfilesImporterPlan(t *testing.T) {
+	AppFs = afero.NewMemMapFs()
+	defer func() { AppFs = afero.NewOsFs() }()
+
+	afero.WriteFile(AppFs, "/home/test/.vimrc", []byte("test"), 0644)
+	afero.WriteFile(AppFs, "/home/test/.config/nvim/init.lua", []byte("test"), 0644)
+	afero.WriteFile(AppFs, "/home/test/.config/nvim/lua/plugins.lua", []byte("test"), 0644)
+	afero.WriteFile(AppFs, "/home/test/.config/gh/hosts.yml", []byte("secret"), 0644)
+	afero.WriteFile(AppFs, "/home/test/.cache/pip/http", []byte("cache"), 0644)
+	afero.WriteFile(AppFs, "/home/test/.config/ian/env.yml", []byte("brew: []"), 0644)
+
+	cases := []struct {
+		Rules    DotfilesRules
+		Mode     LinkMode
+		Expected []string
+	}{
+		{DotfilesRules{}, LinkDirectory, []string{".vimrc", ".config/nvim"}},
+		{DotfilesRules{}, LinkFile, []string{".vimrc", ".config/nvim/init.lua", ".config/nvim/lua/plugins.lua"}},
+		{DotfilesRules{Includes: []string{".config/nvim"}}, LinkDirectory, []string{".config/nvim"}},
+		{DotfilesRules{Excludes: []string{".config/nvim/lua"}}, LinkDirectory, []string{".vimrc", ".config/nvim/init.lua"}},
+		// The directory of the journal is never imported.
+		{DotfilesRules{Includes: []string{".config/ian"}}, LinkDirectory, nil},
+		{DotfilesRules{Includes: []string{".config"}}, LinkDirectory, []string{".config/gh", ".config/nvim"}},
+	}
+	for _, tc := range cases {
+		importer := dotfilesImporter{homeDir: "/home/test", dotfilesDirPath: "/home/test/.dotfiles", journalDir: ".config/ian", rules: tc.Rules, mode: tc.Mode}
+		for _, path := range []string{".cache", ".config", ".vimrc"} {
+			if err := importer.plan(path); err != nil {
+				t.Fatalf("plan func returned an error: %s", err)
+			}
+		}
+		sort.Strings(importer.paths)
+		sort.Strings(tc.Expected)
+		if !reflect.DeepEqual(importer.paths, tc.Expected) {
+			t.Errorf("plan func returned wrong paths with %#v and %s mode: got %#v want %#v",
+				tc.Rules, tc.Mode, importer.paths, tc.Expected)
+		}
+	}
+}
+
+func TestPersistDotfiles(t *testing.T) {
+	defer func() { Git = &GoGitClient{Progress: os.Stdout} }()
+
+	cases := []struct {
+		Force              bool
+		ExpectedOperations []string
+	}{
+		{false, []string{
+			"add /dotfiles", "commit /dotfiles Update dotfiles", "fetch /dotfiles origin",
+			"rebase /dotfiles origin master", "push /dotfiles origin master false",
+		}},
+		{true, []string{
+			"add /dotfiles", "commit /dotfiles Update dotfiles", "push /dotfiles origin master true",
+		}},
+	}
+	for _, tc := range cases {
+		client := &fakeGitClient{}
+		Git = client
+		if err := PersistDotfiles("", "/dotfiles", tc.Force); err != nil {
+			t.Errorf("PersistDotfiles returned an error: %v", err)
+		}
+		if !reflect.DeepEqual(client.Operations, tc.ExpectedOperations) {
+			t.Errorf("PersistDotfiles ran wrong operations: got %v want %v",
+				client.Operations, tc.ExpectedOperations)
+		}
+	}
+}
+
 // func TestEnsureDotfilesRepository(t *testing.T) {
 // 	AppFs = afero.NewMemMapFs()
 // 	execCommand = mockExecCommand
@@ -25,6 +25,10 @@ var ErrOperationNotPermitted = errors.New("Operation not permitted")
 // ErrCannotMoveDotfile is returned when trying create or write without permissions
 var ErrCannotMoveDotfile = errors.New("Couldn't move dotfile")
 
+// ErrCannotRemoveMovedFile is returned when a file has been copied to its new
+// path but can't be removed from the old one
+var ErrCannotRemoveMovedFile = errors.New("Couldn't remove moved file")
+
 // ErrCannotSymlink is returned when trying to create a Symlink and fails
 var ErrCannotSymlink = errors.New("Couldn't create symlink")
 
@@ -36,3 +40,48 @@ var ErrHTTPError = errors.New("Cannot reach endpoint")
 
 // ErrDotfilesRepository is returned when failing to stat a repository
 var ErrDotfilesRepository = errors.New("dotfiles repository doesn't exists or is not reachable")
+
+// ErrNothingToCommit is returned when committing without any staged change
+var ErrNothingToCommit = errors.New("Nothing to commit")
+
+// ErrDotfilesDirNotFound is returned when the dotfiles directory doesn't exist
+var ErrDotfilesDirNotFound = errors.New("dotfiles directory not found, run ian restore first")
+
+// ErrUncommittedDotfiles is returned when updating dotfiles that have uncommitted changes
+var ErrUncommittedDotfiles = errors.New("dotfiles have uncommitted changes, run ian save first")
+
+// ErrInvalidDotfilePath is returned when a dotfile to save isn't in the home directory
+var ErrInvalidDotfilePath = errors.New("dotfiles to save must be in the home directory")
+
+// ErrInvalidLinkMode is returned when dotfiles.link is neither file nor directory
+var ErrInvalidLinkMode = errors.New("dotfiles.link must be file or directory")
+
+// ErrInterruptedImport is returned when saving while a previous dotfiles import has been interrupted
+var ErrInterruptedImport = errors.New("a previous save has been interrupted, run ian save --resume or ian save --rollback")
+
+// ErrNoInterruptedImport is returned when resuming or rolling back without any interrupted dotfiles import
+var ErrNoInterruptedImport = errors.New("no interrupted save to resume or roll back")
+
+// ErrNotLinkedDotfile is returned when unlinking a path that isn't a symlink into the dotfiles directory
+var ErrNotLinkedDotfile = errors.New("not a symlink into the dotfiles directory")
+
+// ErrNoDotfileToUnlink is returned when unlinking without any path
+var ErrNoDotfileToUnlink = errors.New("no dotfile to unlink, give paths or use --all")
+
+// ErrInvalidConflictStrategy is returned when the conflict strategy isn't skip, backup, overwrite or prompt
+var ErrInvalidConflictStrategy = errors.New("conflict strategy must be skip, backup, overwrite or prompt")
+
+// ErrUnsupportedPackageManager is returned when a package manager isn't supported
+var ErrUnsupportedPackageManager = errors.New("unsupported package manager")
+
+// ErrNoLock is returned when restoring the locked packages without env.lock
+var ErrNoLock = errors.New("no env.lock, run ian restore without --frozen first")
+
+// ErrLockOutdated is returned when env.yml declares packages env.lock doesn't contain
+var ErrLockOutdated = errors.New("env.lock is outdated, run ian env sync to update it")
+
+// ErrLockMismatch is returned when an installed version doesn't match env.lock
+var ErrLockMismatch = errors.New("installed version doesn't match env.lock")
+
+// ErrDependencyCycle is returned when package managers depend on each other
+var ErrDependencyCycle = errors.New("package managers depend on each other")
@@ -0,0 +1,612 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/thylong/ian/pkg/dryrun"
+)
+
+// GitClient handles the git operations performed on the dotfiles repository.
+type GitClient interface {
+	Init(dir string, branch string) error
+	Clone(url string, dir string) error
+	SetRemote(dir string, name string, url string) error
+	AddAll(dir string) error
+	Commit(dir string, message string) error
+	Fetch(dir string, remote string) error
+	Rebase(dir string, remote string, branch string) error
+	Push(dir string, remote string, branch string, force bool) error
+	LsRemote(url string) error
+}
+
+// Git is the GitClient used to interact with the dotfiles repository.
+var Git GitClient = &GoGitClient{Progress: os.Stdout}
+
+// GitError is returned when a git operation fails.
+// It matches ErrCannotInteractWithGit with errors.Is.
+type GitError struct {
+	Op  string
+	Err error
+}
+
+func (e *GitError) Error() string {
+	return fmt.Sprintf("git %s: %s", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes every GitError match ErrCannotInteractWithGit.
+func (e *GitError) Is(target error) bool {
+	return target == ErrCannotInteractWithGit
+}
+
+// ConflictError is returned when local and remote commits change the same files.
+type ConflictError struct {
+	Files []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("local and remote changes conflict on: %s", strings.Join(e.Files, ", "))
+}
+
+// GoGitClient is a GitClient implemented in-process with go-git
+// (no git executable required).
+type GoGitClient struct {
+	// Progress receives the progress of network operations (nil to discard).
+	Progress io.Writer
+}
+
+// Init creates a git repository in dir, on the given branch, if it isn't one already.
+func (client *GoGitClient) Init(dir string, branch string) error {
+	repository, err := git.PlainInit(dir, false)
+	if err == git.ErrRepositoryAlreadyExists {
+		return nil
+	} else if err != nil {
+		return &GitError{Op: "init", Err: err}
+	}
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(branch))
+	if err := repository.Storer.SetReference(head); err != nil {
+		return &GitError{Op: "init", Err: err}
+	}
+	return nil
+}
+
+// Clone clones the repository at url into dir.
+func (client *GoGitClient) Clone(url string, dir string) error {
+	auth, err := getAuth(url)
+	if err != nil {
+		return &GitError{Op: "clone", Err: err}
+	}
+	if _, err := git.PlainClone(dir, false, &git.CloneOptions{
+		URL:      url,
+		Auth:     auth,
+		Progress: client.Progress,
+	}); err != nil {
+		return &GitError{Op: "clone", Err: err}
+	}
+	return nil
+}
+
+// SetRemote creates or updates the remote name of the repository in dir.
+func (client *GoGitClient) SetRemote(dir string, name string, url string) error {
+	repository, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "remote", Err: err}
+	}
+	if remote, err := repository.Remote(name); err == nil {
+		if urls := remote.Config().URLs; len(urls) == 1 && urls[0] == url {
+			return nil
+		}
+		if err := repository.DeleteRemote(name); err != nil {
+			return &GitError{Op: "remote", Err: err}
+		}
+	}
+	if _, err := repository.CreateRemote(&gitconfig.RemoteConfig{Name: name, URLs: []string{url}}); err != nil {
+		return &GitError{Op: "remote", Err: err}
+	}
+	return nil
+}
+
+// AddAll stages every change of the working tree of dir (git add -A).
+func (client *GoGitClient) AddAll(dir string) error {
+	_, worktree, err := openWorktree(dir)
+	if err != nil {
+		return &GitError{Op: "add", Err: err}
+	}
+	if err := worktree.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return &GitError{Op: "add", Err: err}
+	}
+	return nil
+}
+
+// Commit records the staged changes of dir. It returns ErrNothingToCommit if
+// there is nothing staged.
+func (client *GoGitClient) Commit(dir string, message string) error {
+	repository, worktree, err := openWorktree(dir)
+	if err != nil {
+		return &GitError{Op: "commit", Err: err}
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return &GitError{Op: "commit", Err: err}
+	}
+	staged := false
+	for _, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified && fileStatus.Staging != git.Untracked {
+			staged = true
+			break
+		}
+	}
+	if !staged {
+		return ErrNothingToCommit
+	}
+	if _, err := worktree.Commit(message, &git.CommitOptions{Author: getSignature(repository)}); err != nil {
+		return &GitError{Op: "commit", Err: err}
+	}
+	return nil
+}
+
+// Fetch retrieves the branches of remote. Empty remotes aren't an error.
+func (client *GoGitClient) Fetch(dir string, remote string) error {
+	repository, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "fetch", Err: err}
+	}
+	remoteConfig, err := repository.Remote(remote)
+	if err != nil {
+		return &GitError{Op: "fetch", Err: err}
+	}
+	auth, err := getAuth(remoteConfig.Config().URLs[0])
+	if err != nil {
+		return &GitError{Op: "fetch", Err: err}
+	}
+	err = repository.Fetch(&git.FetchOptions{RemoteName: remote, Auth: auth, Progress: client.Progress})
+	if err != nil && err != git.NoErrAlreadyUpToDate && err != transport.ErrEmptyRemoteRepository {
+		return &GitError{Op: "fetch", Err: err}
+	}
+	return nil
+}
+
+// Rebase replays the local commits of branch on top of its fetched remote
+// counterpart, fast-forwarding when there are no local commits. Nothing is
+// modified and a *ConflictError is returned when local and remote commits
+// change the same files differently.
+func (client *GoGitClient) Rebase(dir string, remote string, branch string) error {
+	repository, worktree, err := openWorktree(dir)
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	remoteRef, err := repository.Reference(plumbing.NewRemoteReferenceName(remote, branch), true)
+	if err == plumbing.ErrReferenceNotFound {
+		// Nothing to rebase onto (e.g. the remote is empty).
+		return nil
+	} else if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	head, err := repository.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		// No local commit yet: simply check out the remote branch.
+		return resetTo(worktree, remoteRef.Hash())
+	} else if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	if head.Name() != plumbing.NewBranchReferenceName(branch) {
+		return &GitError{Op: "rebase", Err: fmt.Errorf("%s is not checked out", branch)}
+	}
+	if status, err := worktree.Status(); err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	} else if !status.IsClean() {
+		return &GitError{Op: "rebase", Err: git.ErrWorktreeNotClean}
+	}
+
+	local, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	upstream, err := repository.CommitObject(remoteRef.Hash())
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	if local.Hash == upstream.Hash {
+		return nil
+	}
+	if isAncestor, err := upstream.IsAncestor(local); err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	} else if isAncestor {
+		// Only local commits, nothing to rebase.
+		return nil
+	}
+	if isAncestor, err := local.IsAncestor(upstream); err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	} else if isAncestor {
+		return resetTo(worktree, upstream.Hash)
+	}
+
+	var base *object.Commit
+	if bases, err := local.MergeBase(upstream); err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	} else if len(bases) > 0 {
+		base = bases[0]
+	}
+	toReplay, err := getCommitsSince(local, base)
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	if conflicts, err := getConflictingFiles(base, toReplay, upstream); err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	} else if len(conflicts) > 0 {
+		return &ConflictError{Files: conflicts}
+	}
+
+	if err := resetTo(worktree, upstream.Hash); err != nil {
+		return err
+	}
+	for _, commit := range toReplay {
+		if err := replayCommit(dir, repository, worktree, commit); err != nil {
+			// Without reflog, the local commits would be lost: put the branch
+			// back where it was.
+			if resetErr := resetTo(worktree, local.Hash); resetErr != nil {
+				return &GitError{Op: "rebase", Err: fmt.Errorf("%w (cannot reset to %s: %v)", err, local.Hash, errors.Unwrap(resetErr))}
+			}
+			return &GitError{Op: "rebase", Err: err}
+		}
+	}
+	return nil
+}
+
+// Push pushes branch to remote. Already up to date branches aren't an error.
+func (client *GoGitClient) Push(dir string, remote string, branch string, force bool) error {
+	repository, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "push", Err: err}
+	}
+	remoteConfig, err := repository.Remote(remote)
+	if err != nil {
+		return &GitError{Op: "push", Err: err}
+	}
+	auth, err := getAuth(remoteConfig.Config().URLs[0])
+	if err != nil {
+		return &GitError{Op: "push", Err: err}
+	}
+	refSpec := gitconfig.RefSpec(fmt.Sprintf("refs/heads/%s:refs/heads/%s", branch, branch))
+	if force {
+		refSpec = "+" + refSpec
+	}
+	err = repository.Push(&git.PushOptions{
+		RemoteName: remote,
+		RefSpecs:   []gitconfig.RefSpec{refSpec},
+		Auth:       auth,
+		Progress:   client.Progress,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return &GitError{Op: "push", Err: err}
+	}
+	return nil
+}
+
+// LsRemote checks that the repository at url exists and is reachable.
+func (client *GoGitClient) LsRemote(url string) error {
+	auth, err := getAuth(url)
+	if err != nil {
+		return &GitError{Op: "ls-remote", Err: err}
+	}
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{Name: "origin", URLs: []string{url}})
+	// Empty repositories are reachable even though they don't have any reference.
+	if _, err := remote.List(&git.ListOptions{Auth: auth}); err != nil && err != transport.ErrEmptyRemoteRepository {
+		return &GitError{Op: "ls-remote", Err: err}
+	}
+	return nil
+}
+
+// DryRunGitClient records the git operations changing a repository instead
+// of performing them. LsRemote still goes through the wrapped GitClient.
+type DryRunGitClient struct {
+	GitClient
+}
+
+// Init records the creation of the repository in dir.
+func (client *DryRunGitClient) Init(dir string, branch string) error {
+	dryrun.Record("git", "init %s (branch %s)", dir, branch)
+	return nil
+}
+
+// Clone records the clone of url into dir.
+func (client *DryRunGitClient) Clone(url string, dir string) error {
+	dryrun.Record("git", "clone %s %s", url, dir)
+	return nil
+}
+
+// SetRemote records the change of the name remote of the repository in dir.
+func (client *DryRunGitClient) SetRemote(dir string, name string, url string) error {
+	dryrun.Record("git", "remote set-url %s %s (in %s)", name, url, dir)
+	return nil
+}
+
+// AddAll records the staging of the changes of the repository in dir.
+func (client *DryRunGitClient) AddAll(dir string) error {
+	dryrun.Record("git", "add --all (in %s)", dir)
+	return nil
+}
+
+// Commit records the commit of the staged changes of the repository in dir.
+func (client *DryRunGitClient) Commit(dir string, message string) error {
+	dryrun.Record("git", "commit -m %q (in %s)", message, dir)
+	return nil
+}
+
+// Fetch records the fetch of remote into the repository in dir.
+func (client *DryRunGitClient) Fetch(dir string, remote string) error {
+	dryrun.Record("git", "fetch %s (in %s)", remote, dir)
+	return nil
+}
+
+// Rebase records the rebase of the repository in dir onto remote/branch.
+func (client *DryRunGitClient) Rebase(dir string, remote string, branch string) error {
+	dryrun.Record("git", "rebase %s/%s (in %s)", remote, branch, dir)
+	return nil
+}
+
+// Push records the push of branch to remote.
+func (client *DryRunGitClient) Push(dir string, remote string, branch string, force bool) error {
+	if force {
+		dryrun.Record("git", "push --force %s %s (in %s)", remote, branch, dir)
+		return nil
+	}
+	dryrun.Record("git", "push %s %s (in %s)", remote, branch, dir)
+	return nil
+}
+
+// resetTo moves the current branch and the working tree to hash.
+func resetTo(worktree *git.Worktree, hash plumbing.Hash) error {
+	if err := worktree.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	return nil
+}
+
+// getCommitsSince returns the first-parent commits from base (excluded) to
+// commit (included), oldest first. A nil base returns the whole history.
+func getCommitsSince(commit *object.Commit, base *object.Commit) (commits []*object.Commit, err error) {
+	for base == nil || commit.Hash != base.Hash {
+		commits = append([]*object.Commit{commit}, commits...)
+		if commit.NumParents() == 0 {
+			break
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+	return commits, nil
+}
+
+// getTreeEntries returns the files of the tree of commit (nil for no commit).
+func getTreeEntries(commit *object.Commit) (map[string]object.File, error) {
+	entries := make(map[string]object.File)
+	if commit == nil {
+		return entries, nil
+	}
+	files, err := commit.Files()
+	if err != nil {
+		return nil, err
+	}
+	err = files.ForEach(func(file *object.File) error {
+		entries[file.Name] = *file
+		return nil
+	})
+	return entries, err
+}
+
+// getConflictingFiles returns the sorted files changed by upstream since base
+// and by any of the commits to replay, with a content other than upstream's.
+// Commits are checked one by one, as each of them is replayed with its whole
+// files: a change reverted by a later commit still overwrites upstream's.
+func getConflictingFiles(base *object.Commit, commits []*object.Commit, upstream *object.Commit) ([]string, error) {
+	baseTree, err := getTreeEntries(base)
+	if err != nil {
+		return nil, err
+	}
+	upstreamTree, err := getTreeEntries(upstream)
+	if err != nil {
+		return nil, err
+	}
+	same := func(a map[string]object.File, b map[string]object.File, name string) bool {
+		fileA, okA := a[name]
+		fileB, okB := b[name]
+		return okA == okB && fileA.Hash == fileB.Hash && fileA.Mode == fileB.Mode
+	}
+
+	conflicting := make(map[string]bool)
+	before := baseTree
+	for _, commit := range commits {
+		after, err := getTreeEntries(commit)
+		if err != nil {
+			return nil, err
+		}
+		names := make(map[string]bool)
+		for _, tree := range []map[string]object.File{before, after} {
+			for name := range tree {
+				names[name] = true
+			}
+		}
+		for name := range names {
+			if !same(before, after, name) && !same(baseTree, upstreamTree, name) && !same(after, upstreamTree, name) {
+				conflicting[name] = true
+			}
+		}
+		before = after
+	}
+	return sortedKeys(conflicting), nil
+}
+
+// replayCommit applies the changes of commit to the working tree and commits
+// them with the same message and author.
+func replayCommit(dir string, repository *git.Repository, worktree *git.Worktree, commit *object.Commit) error {
+	var parent *object.Commit
+	if commit.NumParents() > 0 {
+		var err error
+		if parent, err = commit.Parent(0); err != nil {
+			return err
+		}
+	}
+	before, err := getTreeEntries(parent)
+	if err != nil {
+		return err
+	}
+	after, err := getTreeEntries(commit)
+	if err != nil {
+		return err
+	}
+
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			if _, err := worktree.Remove(name); err != nil {
+				return err
+			}
+		}
+	}
+	for name, file := range after {
+		if previous, ok := before[name]; ok && previous.Hash == file.Hash && previous.Mode == file.Mode {
+			continue
+		}
+		if err := writeWorktreeFile(filepath.Join(dir, filepath.FromSlash(name)), file); err != nil {
+			return err
+		}
+		if _, err := worktree.Add(name); err != nil {
+			return err
+		}
+	}
+
+	// Like git rebase, drop commits whose changes are already upstream.
+	status, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+	if status.IsClean() {
+		return nil
+	}
+	_, err = worktree.Commit(commit.Message, &git.CommitOptions{
+		Author:    &commit.Author,
+		Committer: getSignature(repository),
+	})
+	return err
+}
+
+// writeWorktreeFile writes file at path, honoring executable and symlink modes.
+func writeWorktreeFile(path string, file object.File) error {
+	content, err := file.Contents()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	os.Remove(path)
+	switch file.Mode {
+	case filemode.Symlink:
+		return os.Symlink(content, path)
+	case filemode.Executable:
+		return os.WriteFile(path, []byte(content), 0755)
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// openWorktree opens the repository in dir and its working tree.
+func openWorktree(dir string) (*git.Repository, *git.Worktree, error) {
+	repository, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return nil, nil, err
+	}
+	return repository, worktree, nil
+}
+
+// getSignature returns the commit signature from the git configuration,
+// defaulting to the current user when user.name or user.email aren't set.
+func getSignature(repository *git.Repository) *object.Signature {
+	signature := &object.Signature{When: time.Now()}
+	if cfg, err := repository.ConfigScoped(gitconfig.SystemScope); err == nil {
+		signature.Name = cfg.User.Name
+		signature.Email = cfg.User.Email
+	}
+	if signature.Name == "" || signature.Email == "" {
+		username := "ian"
+		if usr, err := user.Current(); err == nil {
+			username = usr.Username
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		if signature.Name == "" {
+			signature.Name = username
+		}
+		if signature.Email == "" {
+			signature.Email = fmt.Sprintf("%s@%s", username, hostname)
+		}
+	}
+	return signature
+}
+
+// getAuth returns the authentication method matching url: the SSH agent (or
+// the default private keys) for SSH remotes, none otherwise.
+func getAuth(url string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Protocol != "ssh" {
+		return nil, nil
+	}
+	sshUser := endpoint.User
+	if sshUser == "" {
+		sshUser = "git"
+	}
+	if auth, err := ssh.NewSSHAgentAuth(sshUser); err == nil {
+		return auth, nil
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		if auth, err := ssh.NewPublicKeysFromFile(sshUser, filepath.Join(usr.HomeDir, ".ssh", key), ""); err == nil {
+			return auth, nil
+		}
+	}
+	return nil, errors.New("no SSH agent nor usable private key found")
+}
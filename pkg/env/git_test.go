@@ -0,0 +1,237 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestGoGitClient(t *testing.T) {
+	root := t.TempDir()
+	remotePath := filepath.Join(root, "remote.git")
+	workPath := filepath.Join(root, "work")
+	clonePath := filepath.Join(root, "clone")
+	if _, err := git.PlainInit(remotePath, true); err != nil {
+		t.Fatal(err)
+	}
+	client := &GoGitClient{}
+
+	if err := client.LsRemote(remotePath); err != nil {
+		t.Errorf("LsRemote returned an error on an empty repository: %v", err)
+	}
+	if err := client.LsRemote(filepath.Join(root, "missing.git")); !errors.Is(err, ErrCannotInteractWithGit) {
+		t.Errorf("LsRemote returned wrong err: got %#v want %#v", err, ErrCannotInteractWithGit)
+	}
+
+	if err := client.Init(workPath, "master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Init(workPath, "master"); err != nil {
+		t.Errorf("Init should accept existing repositories: %v", err)
+	}
+	if err := client.SetRemote(workPath, "origin", filepath.Join(root, "old.git")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetRemote(workPath, "origin", remotePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(workPath, ".bashrc"), []byte("export EDITOR=vim\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddAll(workPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Commit(workPath, "Add .bashrc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Commit(workPath, "Empty"); err != ErrNothingToCommit {
+		t.Errorf("Commit returned wrong err: got %#v want %#v", err, ErrNothingToCommit)
+	}
+	if err := client.Push(workPath, "origin", "master", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Push(workPath, "origin", "master", false); err != nil {
+		t.Errorf("Push should accept up to date branches: %v", err)
+	}
+
+	if err := client.Clone(remotePath, clonePath); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(clonePath, ".bashrc")); err != nil || string(content) != "export EDITOR=vim\n" {
+		t.Errorf("Clone didn't retrieve .bashrc: %q %v", content, err)
+	}
+	if err := client.Clone(remotePath, clonePath); !errors.Is(err, ErrCannotInteractWithGit) {
+		t.Errorf("Clone returned wrong err: got %#v want %#v", err, ErrCannotInteractWithGit)
+	}
+}
+
+// commitDotfile writes content to name in dir and commits it with client.
+func commitDotfile(t *testing.T, client GitClient, dir string, name string, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Commit(dir, "Update "+name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoGitClientRebase(t *testing.T) {
+	cases := []struct {
+		Name            string
+		LocalFiles      [][2]string
+		RemoteFiles     map[string]string
+		ExpectedFiles   map[string]string
+		ExpectedCommits int
+		ExpectedErr     error
+	}{
+		{
+			"fast-forward", nil, map[string]string{".vimrc": "remote"},
+			map[string]string{".bashrc": "base", ".vimrc": "remote"}, 2, nil,
+		},
+		{
+			"local only", [][2]string{{".vimrc", "local"}}, nil,
+			map[string]string{".bashrc": "base", ".vimrc": "local"}, 2, nil,
+		},
+		{
+			"diverged", [][2]string{{".vimrc", "local"}}, map[string]string{".zshrc": "remote", ".bashrc": "remote"},
+			map[string]string{".bashrc": "remote", ".vimrc": "local", ".zshrc": "remote"}, 4, nil,
+		},
+		{
+			"same change", [][2]string{{".bashrc", "same"}, {".vimrc", "local"}}, map[string]string{".bashrc": "same"},
+			map[string]string{".bashrc": "same", ".vimrc": "local"}, 3, nil,
+		},
+		{
+			"conflict", [][2]string{{".bashrc", "local"}, {".vimrc", "local"}}, map[string]string{".bashrc": "remote", ".zshrc": "remote"},
+			map[string]string{".bashrc": "local", ".vimrc": "local"}, 3, &ConflictError{Files: []string{".bashrc"}},
+		},
+		{
+			// Replaying the first commit would overwrite the remote change,
+			// even though the second one reverts it.
+			"reverted conflict", [][2]string{{".bashrc", "local"}, {".bashrc", "base"}}, map[string]string{".bashrc": "remote"},
+			map[string]string{".bashrc": "base"}, 3, &ConflictError{Files: []string{".bashrc"}},
+		},
+	}
+	for _, tc := range cases {
+		root := t.TempDir()
+		remotePath := filepath.Join(root, "remote.git")
+		localPath := filepath.Join(root, "local")
+		otherPath := filepath.Join(root, "other")
+		if _, err := git.PlainInit(remotePath, true); err != nil {
+			t.Fatal(err)
+		}
+		client := &GoGitClient{}
+
+		if err := client.Init(localPath, "master"); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.SetRemote(localPath, "origin", remotePath); err != nil {
+			t.Fatal(err)
+		}
+		commitDotfile(t, client, localPath, ".bashrc", "base")
+		if err := client.Push(localPath, "origin", "master", false); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := client.Clone(remotePath, otherPath); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range tc.RemoteFiles {
+			commitDotfile(t, client, otherPath, name, content)
+		}
+		if err := client.Push(otherPath, "origin", "master", false); err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range tc.LocalFiles {
+			commitDotfile(t, client, localPath, file[0], file[1])
+		}
+
+		if err := client.Fetch(localPath, "origin"); err != nil {
+			t.Fatal(err)
+		}
+		err := client.Rebase(localPath, "origin", "master")
+		if !reflect.DeepEqual(err, tc.ExpectedErr) {
+			t.Errorf("%s: Rebase returned wrong err: got %#v want %#v", tc.Name, err, tc.ExpectedErr)
+		}
+
+		for name, expected := range tc.ExpectedFiles {
+			if content, _ := os.ReadFile(filepath.Join(localPath, name)); string(content) != expected {
+				t.Errorf("%s: Rebase left wrong %s content: got %q want %q", tc.Name, name, content, expected)
+			}
+		}
+		repository, _ := git.PlainOpen(localPath)
+		commits, _ := repository.Log(&git.LogOptions{})
+		count := 0
+		commits.ForEach(func(*object.Commit) error { count++; return nil })
+		if count != tc.ExpectedCommits {
+			t.Errorf("%s: Rebase left wrong number of commits: got %d want %d", tc.Name, count, tc.ExpectedCommits)
+		}
+
+		if tc.ExpectedErr == nil {
+			if err := client.Push(localPath, "origin", "master", false); err != nil {
+				t.Errorf("%s: Push after Rebase failed: %v", tc.Name, err)
+			}
+		}
+	}
+}
+
+func TestGoGitClientRebaseFailedReplay(t *testing.T) {
+	root := t.TempDir()
+	remotePath := filepath.Join(root, "remote.git")
+	localPath := filepath.Join(root, "local")
+	otherPath := filepath.Join(root, "other")
+	if _, err := git.PlainInit(remotePath, true); err != nil {
+		t.Fatal(err)
+	}
+	client := &GoGitClient{}
+	if err := client.Init(localPath, "master"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetRemote(localPath, "origin", remotePath); err != nil {
+		t.Fatal(err)
+	}
+	commitDotfile(t, client, localPath, ".bashrc", "base")
+	if err := client.Push(localPath, "origin", "master", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Clone(remotePath, otherPath); err != nil {
+		t.Fatal(err)
+	}
+	// Upstream adds a nvim file while a local commit adds a nvim directory,
+	// which can't be replayed.
+	commitDotfile(t, client, otherPath, "nvim", "remote")
+	if err := client.Push(otherPath, "origin", "master", false); err != nil {
+		t.Fatal(err)
+	}
+	commitDotfile(t, client, localPath, ".vimrc", "local")
+	if err := os.Mkdir(filepath.Join(localPath, "nvim"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	commitDotfile(t, client, localPath, "nvim/init.lua", "local")
+	if err := client.Fetch(localPath, "origin"); err != nil {
+		t.Fatal(err)
+	}
+	repository, _ := git.PlainOpen(localPath)
+	head, _ := repository.Head()
+
+	if err := client.Rebase(localPath, "origin", "master"); !errors.Is(err, ErrCannotInteractWithGit) {
+		t.Fatalf("Rebase returned wrong err: got %v want %v", err, ErrCannotInteractWithGit)
+	}
+	if after, _ := repository.Head(); after.Hash() != head.Hash() {
+		t.Errorf("Rebase didn't restore the local commits: HEAD at %s want %s", after.Hash(), head.Hash())
+	}
+	for name, expected := range map[string]string{".vimrc": "local", "nvim/init.lua": "local"} {
+		if content, _ := os.ReadFile(filepath.Join(localPath, name)); string(content) != expected {
+			t.Errorf("Rebase left wrong %s content: got %q want %q", name, content, expected)
+		}
+	}
+}
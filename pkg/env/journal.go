@@ -0,0 +1,225 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
+	"github.com/thylong/ian/pkg/log"
+)
+
+// ImportJournalPath is the path of the journal of the dotfiles import in
+// progress. Imports never move its directory, see dotfilesImporter.
+var ImportJournalPath = filepath.Join(config.IanConfigPath, "save.journal")
+
+// JournalState is the progress of a dotfile import.
+type JournalState string
+
+const (
+	// JournalPending means the dotfile hasn't been moved yet.
+	JournalPending JournalState = "pending"
+	// JournalMoved means the dotfile has been moved into the dotfiles directory.
+	JournalMoved JournalState = "moved"
+	// JournalLinked means the dotfile has been moved and replaced by a symlink.
+	JournalLinked JournalState = "linked"
+)
+
+// JournalEntry records the import of a dotfile.
+type JournalEntry struct {
+	Src   string       `json:"src"`
+	Dst   string       `json:"dst"`
+	State JournalState `json:"state"`
+}
+
+// Journal records every step of a dotfiles import, so that an interrupted
+// import can be resumed or rolled back.
+type Journal struct {
+	Entries []JournalEntry `json:"entries"`
+
+	path string
+}
+
+// ImportError is returned when a dotfile import fails.
+type ImportError struct {
+	Src string
+	Op  string
+	Err error
+	// RolledBack is set when the dotfiles already imported have been restored.
+	RolledBack bool
+}
+
+func (e *ImportError) Error() string {
+	msg := fmt.Sprintf("cannot %s %s: %s", e.Op, e.Src, e.Err)
+	if e.RolledBack {
+		msg += " (import rolled back)"
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes an ImportError match ErrCannotMoveDotfile or ErrCannotSymlink
+// depending on the failing operation.
+func (e *ImportError) Is(target error) bool {
+	return (e.Op == "move" && target == ErrCannotMoveDotfile) || (e.Op == "symlink" && target == ErrCannotSymlink)
+}
+
+// NewJournal returns a Journal, stored at path, of the import of every src
+// path to the dst path with the same index.
+func NewJournal(path string, srcs []string, dsts []string) *Journal {
+	journal := &Journal{path: path}
+	for i := range srcs {
+		journal.Entries = append(journal.Entries, JournalEntry{Src: srcs[i], Dst: dsts[i], State: JournalPending})
+	}
+	return journal
+}
+
+// LoadJournal returns the Journal stored at path, or nil if there is none.
+func LoadJournal(path string) (*Journal, error) {
+	content, err := afero.ReadFile(AppFs, path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	journal := &Journal{path: path}
+	if err = json.Unmarshal(content, journal); err != nil {
+		return nil, ErrJSONPayloadInvalidFormat
+	}
+	return journal, nil
+}
+
+// Save writes the journal.
+func (j *Journal) Save() error {
+	content, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = AppFs.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+	return afero.WriteFile(AppFs, j.path, content, 0644)
+}
+
+// Remove deletes the journal once the import is over.
+func (j *Journal) Remove() error {
+	if err := AppFs.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Run imports every dotfile not imported yet, recording each step. If a step
+// fails, every dotfile already imported is restored.
+func (j *Journal) Run() error {
+	if err := j.Save(); err != nil {
+		return err
+	}
+	for i := range j.Entries {
+		if err := j.runEntry(&j.Entries[i]); err != nil {
+			if rollbackErr := j.Rollback(); rollbackErr != nil {
+				log.Errorf("Rollback failed, run ian save --rollback: %s\n", rollbackErr)
+				return err
+			}
+			err.RolledBack = true
+			return err
+		}
+	}
+	return j.Remove()
+}
+
+// runEntry moves the dotfile into the dotfiles directory, then replaces it by
+// a symlink. The actual state of the files prevails over the recorded one, in
+// case the previous run was interrupted between a step and its record.
+func (j *Journal) runEntry(entry *JournalEntry) *ImportError {
+	if isLinkedDotfile(entry.Src, entry.Dst) {
+		return j.record(entry, JournalLinked)
+	}
+	if !isMovedDotfile(entry.Src, entry.Dst) {
+		if err := MoveFile(entry.Src, entry.Dst); err != nil {
+			// The copy is complete, so src has to be restored from it.
+			if errors.Is(err, ErrCannotRemoveMovedFile) {
+				j.record(entry, JournalMoved)
+			}
+			return &ImportError{Src: entry.Src, Op: "move", Err: err}
+		}
+		if err := j.record(entry, JournalMoved); err != nil {
+			return err
+		}
+	}
+	if err := dryrun.Symlink(entry.Dst, entry.Src); err != nil {
+		return &ImportError{Src: entry.Src, Op: "symlink", Err: err}
+	}
+	return j.record(entry, JournalLinked)
+}
+
+// record updates the state of the entry and saves the journal.
+func (j *Journal) record(entry *JournalEntry, state JournalState) *ImportError {
+	entry.State = state
+	if err := j.Save(); err != nil {
+		return &ImportError{Src: entry.Src, Op: "record", Err: err}
+	}
+	return nil
+}
+
+// Rollback restores, in reverse order, every dotfile already moved into the
+// dotfiles directory, then removes the journal. A dotfile recorded as moved
+// is restored even if something has been created at its path since.
+func (j *Journal) Rollback() error {
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		entry := &j.Entries[i]
+		if isLinkedDotfile(entry.Src, entry.Dst) {
+			if err := AppFs.Remove(entry.Src); err != nil {
+				return err
+			}
+		}
+		if isMovedDotfile(entry.Src, entry.Dst) || (entry.State != JournalPending && exists(entry.Dst)) {
+			if err := MoveFile(entry.Dst, entry.Src); err != nil {
+				return err
+			}
+		}
+		entry.State = JournalPending
+		if err := j.Save(); err != nil {
+			return err
+		}
+	}
+	return j.Remove()
+}
+
+// exists returns whether something exists at path, symlinks included.
+func exists(path string) bool {
+	_, err := lstat(path)
+	return err == nil
+}
+
+// isMovedDotfile returns whether src has been moved to dst.
+func isMovedDotfile(src string, dst string) bool {
+	if _, err := lstat(src); !os.IsNotExist(err) {
+		return false
+	}
+	_, err := lstat(dst)
+	return err == nil
+}
@@ -0,0 +1,115 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupJournal(t *testing.T, names ...string) (journal *Journal, homeDir string, dotfilesDirPath string) {
+	homeDir = t.TempDir()
+	dotfilesDirPath = t.TempDir()
+
+	var srcs, dsts []string
+	for _, name := range names {
+		srcs = append(srcs, filepath.Join(homeDir, name))
+		dsts = append(dsts, filepath.Join(dotfilesDirPath, name))
+	}
+	return NewJournal(filepath.Join(t.TempDir(), "save.journal"), srcs, dsts), homeDir, dotfilesDirPath
+}
+
+func TestJournalRun(t *testing.T) {
+	journal, homeDir, dotfilesDirPath := setupJournal(t, ".bashrc", ".vimrc")
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bashrc"), 0644)
+	// .vimrc has been moved by an interrupted run.
+	os.WriteFile(filepath.Join(dotfilesDirPath, ".vimrc"), []byte("vimrc"), 0644)
+
+	if err := journal.Run(); err != nil {
+		t.Fatalf("Run func returned an error: %s", err)
+	}
+	for _, name := range []string{".bashrc", ".vimrc"} {
+		if !isLinkedDotfile(filepath.Join(homeDir, name), filepath.Join(dotfilesDirPath, name)) {
+			t.Errorf("Run func didn't link %s", name)
+		}
+	}
+	if _, err := os.Stat(journal.path); !os.IsNotExist(err) {
+		t.Errorf("Run func didn't remove the journal")
+	}
+}
+
+func TestJournalRunRollback(t *testing.T) {
+	journal, homeDir, _ := setupJournal(t, ".bashrc", ".missing")
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bashrc"), 0644)
+
+	err := journal.Run()
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || !importErr.RolledBack || !errors.Is(err, ErrCannotMoveDotfile) {
+		t.Fatalf("Run func returned wrong error: got %#v", err)
+	}
+	fi, err := os.Lstat(filepath.Join(homeDir, ".bashrc"))
+	if err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("Run func didn't restore .bashrc")
+	}
+	if _, err := os.Stat(journal.path); !os.IsNotExist(err) {
+		t.Errorf("Run func didn't remove the journal")
+	}
+}
+
+func TestJournalRunRollbackRecreatedSrc(t *testing.T) {
+	homeDir := t.TempDir()
+	dotfilesDirPath := t.TempDir()
+	src := filepath.Join(homeDir, ".config", "ian")
+	dst := filepath.Join(dotfilesDirPath, ".config", "ian")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(src, "env.yml"), []byte("brew: [git]"), 0644)
+	os.MkdirAll(filepath.Dir(dst), 0755)
+	// The journal recreates src once it's moved, so it can't be linked.
+	journal := NewJournal(filepath.Join(src, "save.journal"), []string{src}, []string{dst})
+
+	var importErr *ImportError
+	if err := journal.Run(); !errors.As(err, &importErr) || !importErr.RolledBack {
+		t.Fatalf("Run func returned wrong error: got %#v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(src, "env.yml")); err != nil || string(content) != "brew: [git]" {
+		t.Errorf("Run func didn't restore env.yml: got (%q, %v)", content, err)
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("Run func left %s in the dotfiles directory", dst)
+	}
+}
+
+func TestJournalRollback(t *testing.T) {
+	journal, homeDir, dotfilesDirPath := setupJournal(t, ".bashrc", ".vimrc")
+	os.WriteFile(filepath.Join(homeDir, ".bashrc"), []byte("bashrc"), 0644)
+	os.WriteFile(filepath.Join(homeDir, ".vimrc"), []byte("vimrc"), 0644)
+	journal.runEntry(&journal.Entries[0])
+	journal.Save()
+
+	loaded, err := LoadJournal(journal.path)
+	if err != nil || loaded == nil {
+		t.Fatalf("LoadJournal func returned wrong journal: got (%#v, %#v)", loaded, err)
+	}
+	if loaded.Entries[0].State != JournalLinked || loaded.Entries[1].State != JournalPending {
+		t.Errorf("LoadJournal func returned wrong states: got %#v", loaded.Entries)
+	}
+	if err := loaded.Rollback(); err != nil {
+		t.Fatalf("Rollback func returned an error: %s", err)
+	}
+	for name, expected := range map[string]string{".bashrc": "bashrc", ".vimrc": "vimrc"} {
+		fi, err := os.Lstat(filepath.Join(homeDir, name))
+		if err != nil || !fi.Mode().IsRegular() {
+			t.Errorf("Rollback func didn't restore %s", name)
+			continue
+		}
+		if content, _ := os.ReadFile(filepath.Join(homeDir, name)); string(content) != expected {
+			t.Errorf("Rollback func restored wrong content for %s: got %q want %q", name, content, expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dotfilesDirPath, ".bashrc")); !os.IsNotExist(err) {
+		t.Errorf("Rollback func left .bashrc in the dotfiles directory")
+	}
+	if journal, err := LoadJournal(journal.path); journal != nil || err != nil {
+		t.Errorf("Rollback func didn't remove the journal")
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
+	"github.com/thylong/ian/pkg/log"
+)
+
+// LinkReport summarizes the outcome of linking dotfiles into the home directory.
+type LinkReport struct {
+	// Linked contains the dotfiles newly linked.
+	Linked []string
+	// Skipped contains the dotfiles not linked because a file already exists.
+	Skipped []string
+	// BackedUp contains the existing files moved to BackupDir before linking.
+	BackedUp []string
+	// Overwritten contains the existing files removed before linking.
+	Overwritten []string
+	// BackupDir is the directory the existing files have been moved to.
+	BackupDir string
+}
+
+// LinkMode sets whether dotfiles directories are linked as a whole or file by file.
+type LinkMode string
+
+const (
+	// LinkDirectory links directories as a whole.
+	LinkDirectory LinkMode = "directory"
+	// LinkFile links every file individually, directories being created.
+	LinkFile LinkMode = "file"
+)
+
+// GetLinkMode returns the link mode set by dotfiles.link in config.yml
+// (directory by default).
+func GetLinkMode() (LinkMode, error) {
+	switch mode := LinkMode(config.GetDotfilesLink()); mode {
+	case "":
+		return LinkDirectory, nil
+	case LinkDirectory, LinkFile:
+		return mode, nil
+	default:
+		return "", ErrInvalidLinkMode
+	}
+}
+
+// ConflictStrategy sets what to do when a file already exists where a
+// dotfile has to be linked.
+type ConflictStrategy string
+
+const (
+	// ConflictSkip leaves the existing file untouched.
+	ConflictSkip ConflictStrategy = "skip"
+	// ConflictBackup moves the existing file to the backup directory.
+	ConflictBackup ConflictStrategy = "backup"
+	// ConflictOverwrite removes the existing file.
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	// ConflictPrompt asks which strategy to use for every conflict.
+	ConflictPrompt ConflictStrategy = "prompt"
+)
+
+// GetConflictStrategy returns the given conflict strategy or, if empty, the
+// one set by dotfiles.conflict in config.yml (backup by default).
+func GetConflictStrategy(strategy string) (ConflictStrategy, error) {
+	if strategy == "" {
+		strategy = config.GetDotfilesConflict()
+	}
+	switch conflict := ConflictStrategy(strategy); conflict {
+	case "":
+		return ConflictBackup, nil
+	case ConflictSkip, ConflictBackup, ConflictOverwrite, ConflictPrompt:
+		return conflict, nil
+	default:
+		return "", ErrInvalidConflictStrategy
+	}
+}
+
+// LinkOptions sets how dotfiles are linked into the home directory.
+type LinkOptions struct {
+	Mode     LinkMode
+	Conflict ConflictStrategy
+	// BackupDir is the directory existing files are moved to with ConflictBackup.
+	BackupDir string
+}
+
+// GetLinkOptions returns the LinkOptions set in config.yml, the conflict
+// strategy being overridden by conflict if set. Backups go to a timestamped
+// directory under ~/.config/ian/backups.
+func GetLinkOptions(conflict string) (opts LinkOptions, err error) {
+	if opts.Mode, err = GetLinkMode(); err != nil {
+		return opts, err
+	}
+	if opts.Conflict, err = GetConflictStrategy(conflict); err != nil {
+		return opts, err
+	}
+	opts.BackupDir = filepath.Join(config.IanConfigPath, "backups", time.Now().Format("20060102-150405"))
+	return opts, nil
+}
+
+var getUserInput = config.GetUserInput
+
+// promptConflict asks which strategy to use for the conflict on name. An
+// empty answer skips it, so that a closed or non-interactive stdin doesn't
+// ask forever.
+var promptConflict = func(name string) ConflictStrategy {
+	for {
+		in := strings.ToLower(getUserInput(fmt.Sprintf("%s already exists: [S]kip, [b]ackup or [o]verwrite?", name)))
+		switch in {
+		case "", "s", "skip":
+			return ConflictSkip
+		case "b", "backup":
+			return ConflictBackup
+		case "o", "overwrite":
+			return ConflictOverwrite
+		}
+	}
+}
+
+var gitFilesRegexp = regexp.MustCompile(".git$")
+
+// LinkDotfiles symlinks the entries of the dotfiles directory into homeDir,
+// keeping their relative paths. Directories existing on both sides are
+// merged, others are linked as a whole or file by file depending on the link
+// mode. Entries already linked are ignored, other existing files are handled
+// according to the conflict strategy.
+func LinkDotfiles(dotfilesDirPath string, homeDir string, opts LinkOptions) (report LinkReport, err error) {
+	l := &linker{dotfilesDirPath: dotfilesDirPath, homeDir: homeDir, opts: opts}
+	err = l.linkDir("")
+	return l.report, err
+}
+
+// linker links dotfiles and reports the outcome.
+type linker struct {
+	dotfilesDirPath string
+	homeDir         string
+	opts            LinkOptions
+
+	report LinkReport
+}
+
+// linkDir links the content of the path directory of the dotfiles directory.
+func (l *linker) linkDir(path string) error {
+	files, err := ioutil.ReadDir(filepath.Join(l.dotfilesDirPath, path))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if path == "" && gitFilesRegexp.MatchString(f.Name()) {
+			continue
+		}
+		name := filepath.Join(path, f.Name())
+		src := filepath.Join(l.dotfilesDirPath, name)
+		dst := filepath.Join(l.homeDir, name)
+
+		if fi, err := os.Lstat(dst); err == nil {
+			if target, err := os.Readlink(dst); err == nil && target == src {
+				continue
+			}
+			if fi.IsDir() && f.IsDir() {
+				if err := l.linkDir(name); err != nil {
+					return err
+				}
+				continue
+			}
+			resolved, err := l.resolveConflict(name)
+			if err != nil {
+				return err
+			}
+			if !resolved {
+				continue
+			}
+		}
+		if f.IsDir() && l.opts.Mode == LinkFile {
+			if err := dryrun.MkdirAll(dst, f.Mode().Perm()); err != nil {
+				return ErrCannotSymlink
+			}
+			if err := l.linkDir(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := dryrun.Symlink(src, dst); err != nil {
+			return ErrCannotSymlink
+		}
+		l.report.Linked = append(l.report.Linked, name)
+	}
+	return nil
+}
+
+// resolveConflict applies the conflict strategy to the file existing at name
+// and returns whether the dotfile can be linked.
+func (l *linker) resolveConflict(name string) (bool, error) {
+	dst := filepath.Join(l.homeDir, name)
+
+	strategy := l.opts.Conflict
+	if strategy == ConflictPrompt {
+		strategy = promptConflict(name)
+	}
+	switch strategy {
+	case ConflictBackup:
+		backup := filepath.Join(l.opts.BackupDir, name)
+		if err := dryrun.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+			return false, err
+		}
+		if err := MoveFile(dst, backup); err != nil {
+			return false, fmt.Errorf("cannot back up %s: %w", name, err)
+		}
+		l.report.BackedUp = append(l.report.BackedUp, name)
+		l.report.BackupDir = l.opts.BackupDir
+		return true, nil
+	case ConflictOverwrite:
+		if err := dryrun.RemoveAll(dst); err != nil {
+			return false, err
+		}
+		l.report.Overwritten = append(l.report.Overwritten, name)
+		return true, nil
+	default:
+		l.report.Skipped = append(l.report.Skipped, name)
+		return false, nil
+	}
+}
+
+// FindDanglingDotfiles returns the paths, relative to homeDir, of the symlinks
+// into the dotfiles directory whose target doesn't exist anymore. Only the
+// directories that also exist in the dotfiles directory are searched.
+func FindDanglingDotfiles(dotfilesDirPath string, homeDir string) (dangling []string, err error) {
+	err = walkDotfilesLinks(dotfilesDirPath, homeDir, "", func(name string) {
+		if _, err := os.Stat(filepath.Join(homeDir, name)); os.IsNotExist(err) {
+			dangling = append(dangling, name)
+		}
+	})
+	return dangling, err
+}
+
+// FindLinkedDotfiles returns the paths, relative to homeDir, of the symlinks
+// into the dotfiles directory found in the path directory of homeDir. Only
+// the directories that also exist in the dotfiles directory are searched.
+func FindLinkedDotfiles(dotfilesDirPath string, homeDir string, path string) (linked []string, err error) {
+	err = walkDotfilesLinks(dotfilesDirPath, homeDir, path, func(name string) {
+		linked = append(linked, name)
+	})
+	return linked, err
+}
+
+// walkDotfilesLinks calls fn with the path, relative to homeDir, of every
+// symlink into the dotfiles directory found in the path directory of homeDir.
+func walkDotfilesLinks(dotfilesDirPath string, homeDir string, path string, fn func(name string)) error {
+	files, err := ioutil.ReadDir(filepath.Join(homeDir, path))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := filepath.Join(path, f.Name())
+		dst := filepath.Join(homeDir, name)
+
+		if f.IsDir() {
+			if fi, err := os.Lstat(filepath.Join(dotfilesDirPath, name)); err == nil && fi.IsDir() {
+				if err := walkDotfilesLinks(dotfilesDirPath, homeDir, name, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if f.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := os.Readlink(dst)
+		if err != nil || !strings.HasPrefix(target, dotfilesDirPath+string(filepath.Separator)) {
+			continue
+		}
+		fn(name)
+	}
+	return nil
+}
+
+// UnlinkDotfiles replaces the symlinks into the dotfiles directory found at
+// the given paths, relative to homeDir, by a copy of their target. Paths of
+// directories are searched for symlinks. With remove, the targets are moved
+// out of the dotfiles directory instead of copied.
+func UnlinkDotfiles(paths []string, dotfilesDirPath string, homeDir string, remove bool) (unlinked []string, err error) {
+	var links []string
+	for _, path := range paths {
+		src := filepath.Join(homeDir, path)
+		fi, err := os.Lstat(src)
+		if err != nil {
+			return nil, &UnlinkError{Path: path, Err: ErrNotLinkedDotfile}
+		}
+		if fi.IsDir() {
+			found, err := FindLinkedDotfiles(dotfilesDirPath, homeDir, path)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, found...)
+			continue
+		}
+		if target, err := os.Readlink(src); err != nil || !strings.HasPrefix(target, dotfilesDirPath+string(filepath.Separator)) {
+			return nil, &UnlinkError{Path: path, Err: ErrNotLinkedDotfile}
+		}
+		links = append(links, path)
+	}
+
+	for _, link := range links {
+		if err := unlinkDotfile(filepath.Join(homeDir, link), remove); err != nil {
+			return unlinked, &UnlinkError{Path: link, Err: err}
+		}
+		unlinked = append(unlinked, link)
+	}
+	return unlinked, nil
+}
+
+// unlinkDotfile replaces the symlink at src by a copy of its target, or by
+// its target with remove. The symlink is restored on failure.
+func unlinkDotfile(src string, remove bool) (err error) {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if err = dryrun.Remove(src); err != nil {
+		return err
+	}
+	switch {
+	case remove:
+		err = MoveFile(target, src)
+	case fi.IsDir():
+		err = copyDir(target, src, copyFileWithMode)
+	default:
+		err = copyFileWithMode(target, src)
+	}
+	if err != nil {
+		dryrun.RemoveAll(src)
+		if linkErr := dryrun.Symlink(target, src); linkErr != nil {
+			log.Errorf("Couldn't restore the %s symlink to %s: %s\n", src, target, linkErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// UnlinkError is returned when a dotfile can't be unlinked.
+type UnlinkError struct {
+	Path string
+	Err  error
+}
+
+func (e *UnlinkError) Error() string {
+	return fmt.Sprintf("cannot unlink %s: %s", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *UnlinkError) Unwrap() error {
+	return e.Err
+}
+
+// PrintLinkReport logs what has been linked, skipped, backed up and overwritten.
+func PrintLinkReport(report LinkReport) {
+	for _, name := range report.Linked {
+		log.Infof("Linked %s\n", name)
+	}
+	for _, name := range report.BackedUp {
+		log.Infof("Backed up %s to %s\n", name, filepath.Join(report.BackupDir, name))
+	}
+	for _, name := range report.Overwritten {
+		log.Warningf("Overwrote %s\n", name)
+	}
+	for _, name := range report.Skipped {
+		log.Warningf("Skipped %s: a file already exists in your home directory\n", name)
+	}
+	log.Infof("%d dotfiles linked, %d backed up, %d overwritten, %d skipped\n",
+		len(report.Linked), len(report.BackedUp), len(report.Overwritten), len(report.Skipped))
+}
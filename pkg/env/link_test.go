@@ -0,0 +1,244 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thylong/ian/pkg/dryrun"
+)
+
+func TestLinkDotfiles(t *testing.T) {
+	dotfilesDirPath := t.TempDir()
+	homeDir := t.TempDir()
+
+	for _, name := range []string{".bashrc", ".vimrc", ".zshrc"} {
+		os.WriteFile(filepath.Join(dotfilesDirPath, name), []byte("test"), 0644)
+	}
+	os.Mkdir(filepath.Join(dotfilesDirPath, ".git"), 0755)
+	os.Symlink(filepath.Join(dotfilesDirPath, ".bashrc"), filepath.Join(homeDir, ".bashrc"))
+	os.WriteFile(filepath.Join(homeDir, ".zshrc"), []byte("local"), 0644)
+
+	report, err := LinkDotfiles(dotfilesDirPath, homeDir, LinkOptions{Mode: LinkDirectory, Conflict: ConflictSkip})
+	if err != nil {
+		t.Fatalf("LinkDotfiles func returned an error: %s", err)
+	}
+	expected := LinkReport{Linked: []string{".vimrc"}, Skipped: []string{".zshrc"}}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("LinkDotfiles func returned wrong report: got %#v want %#v", report, expected)
+	}
+	if _, err := os.Lstat(filepath.Join(homeDir, ".git")); err == nil {
+		t.Errorf("LinkDotfiles func linked the .git directory")
+	}
+}
+
+func TestLinkDotfilesDryRun(t *testing.T) {
+	dotfilesDirPath := t.TempDir()
+	homeDir := t.TempDir()
+	os.WriteFile(filepath.Join(dotfilesDirPath, ".vimrc"), []byte("test"), 0644)
+
+	dryrun.Enable(nil)
+	defer dryrun.Disable()
+	if _, err := LinkDotfiles(dotfilesDirPath, homeDir, LinkOptions{Mode: LinkDirectory, Conflict: ConflictSkip}); err != nil {
+		t.Fatalf("LinkDotfiles func returned an error: %s", err)
+	}
+	if _, err := os.Lstat(filepath.Join(homeDir, ".vimrc")); err == nil {
+		t.Errorf("LinkDotfiles func linked .vimrc in dry run")
+	}
+	expected := []dryrun.Operation{{Kind: "symlink", Description: filepath.Join(homeDir, ".vimrc") + " -> " + filepath.Join(dotfilesDirPath, ".vimrc")}}
+	if operations := dryrun.Operations(); !reflect.DeepEqual(operations, expected) {
+		t.Errorf("LinkDotfiles func recorded wrong operations: got %#v want %#v", operations, expected)
+	}
+}
+
+func TestLinkDotfilesNested(t *testing.T) {
+	cases := []struct {
+		Mode     LinkMode
+		Expected LinkReport
+	}{
+		{LinkDirectory, LinkReport{Linked: []string{".config/nvim", ".vim"}}},
+		{LinkFile, LinkReport{Linked: []string{".config/nvim/init.lua", ".vim/colors/theme.vim"}}},
+	}
+	for _, tc := range cases {
+		dotfilesDirPath := t.TempDir()
+		homeDir := t.TempDir()
+
+		os.MkdirAll(filepath.Join(dotfilesDirPath, ".config", "nvim"), 0755)
+		os.WriteFile(filepath.Join(dotfilesDirPath, ".config", "nvim", "init.lua"), []byte("test"), 0644)
+		os.MkdirAll(filepath.Join(dotfilesDirPath, ".vim", "colors"), 0755)
+		os.WriteFile(filepath.Join(dotfilesDirPath, ".vim", "colors", "theme.vim"), []byte("test"), 0644)
+		os.MkdirAll(filepath.Join(homeDir, ".config"), 0755)
+
+		report, err := LinkDotfiles(dotfilesDirPath, homeDir, LinkOptions{Mode: tc.Mode, Conflict: ConflictSkip})
+		if err != nil {
+			t.Fatalf("LinkDotfiles func returned an error: %s", err)
+		}
+		if !reflect.DeepEqual(report, tc.Expected) {
+			t.Errorf("LinkDotfiles func returned wrong report with %s mode: got %#v want %#v", tc.Mode, report, tc.Expected)
+		}
+		if content, err := os.ReadFile(filepath.Join(homeDir, ".config", "nvim", "init.lua")); err != nil || string(content) != "test" {
+			t.Errorf("LinkDotfiles func didn't link .config/nvim/init.lua with %s mode", tc.Mode)
+		}
+	}
+}
+
+func TestLinkDotfilesConflict(t *testing.T) {
+	defer func(prompt func(string) ConflictStrategy) { promptConflict = prompt }(promptConflict)
+	promptConflict = func(name string) ConflictStrategy { return ConflictOverwrite }
+
+	cases := []struct {
+		Conflict       ConflictStrategy
+		Expected       LinkReport
+		ExpectedBackup bool
+	}{
+		{ConflictSkip, LinkReport{Skipped: []string{".zshrc"}}, false},
+		{ConflictBackup, LinkReport{Linked: []string{".zshrc"}, BackedUp: []string{".zshrc"}}, true},
+		{ConflictOverwrite, LinkReport{Linked: []string{".zshrc"}, Overwritten: []string{".zshrc"}}, false},
+		{ConflictPrompt, LinkReport{Linked: []string{".zshrc"}, Overwritten: []string{".zshrc"}}, false},
+	}
+	for _, tc := range cases {
+		dotfilesDirPath := t.TempDir()
+		homeDir := t.TempDir()
+		backupDir := filepath.Join(t.TempDir(), "backup")
+
+		os.WriteFile(filepath.Join(dotfilesDirPath, ".zshrc"), []byte("ours"), 0644)
+		os.WriteFile(filepath.Join(homeDir, ".zshrc"), []byte("default"), 0644)
+
+		report, err := LinkDotfiles(dotfilesDirPath, homeDir, LinkOptions{Mode: LinkDirectory, Conflict: tc.Conflict, BackupDir: backupDir})
+		if err != nil {
+			t.Fatalf("LinkDotfiles func returned an error: %s", err)
+		}
+		if tc.ExpectedBackup {
+			tc.Expected.BackupDir = backupDir
+		}
+		if !reflect.DeepEqual(report, tc.Expected) {
+			t.Errorf("LinkDotfiles func returned wrong report with %s: got %#v want %#v", tc.Conflict, report, tc.Expected)
+		}
+		content, _ := os.ReadFile(filepath.Join(backupDir, ".zshrc"))
+		if tc.ExpectedBackup != (string(content) == "default") {
+			t.Errorf("LinkDotfiles func returned wrong backup with %s: got %q", tc.Conflict, content)
+		}
+	}
+}
+
+func TestPromptConflict(t *testing.T) {
+	defer func(input func(string) string) { getUserInput = input }(getUserInput)
+	cases := []struct {
+		Answers  []string
+		Expected ConflictStrategy
+	}{
+		{[]string{"b"}, ConflictBackup},
+		{[]string{"what", "Overwrite"}, ConflictOverwrite},
+		// EOF and non-interactive stdin return an empty answer.
+		{[]string{""}, ConflictSkip},
+	}
+	for _, tc := range cases {
+		answers := tc.Answers
+		getUserInput = func(string) string {
+			answer := answers[0]
+			answers = answers[1:]
+			return answer
+		}
+		if strategy := promptConflict(".zshrc"); strategy != tc.Expected {
+			t.Errorf("promptConflict func returned wrong strategy for %v: got %s want %s", tc.Answers, strategy, tc.Expected)
+		}
+	}
+}
+
+func TestGetConflictStrategy(t *testing.T) {
+	cases := []struct {
+		Strategy    string
+		Expected    ConflictStrategy
+		ExpectedErr error
+	}{
+		{"skip", ConflictSkip, nil},
+		{"prompt", ConflictPrompt, nil},
+		{"merge", "", ErrInvalidConflictStrategy},
+	}
+	for _, tc := range cases {
+		if got, err := GetConflictStrategy(tc.Strategy); got != tc.Expected || err != tc.ExpectedErr {
+			t.Errorf("GetConflictStrategy func returned wrong value for %s: got (%s, %#v) want (%s, %#v)",
+				tc.Strategy, got, err, tc.Expected, tc.ExpectedErr)
+		}
+	}
+}
+
+func TestFindDanglingDotfiles(t *testing.T) {
+	dotfilesDirPath := t.TempDir()
+	homeDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(dotfilesDirPath, ".vimrc"), []byte("test"), 0644)
+	os.Symlink(filepath.Join(dotfilesDirPath, ".vimrc"), filepath.Join(homeDir, ".vimrc"))
+	os.Symlink(filepath.Join(dotfilesDirPath, ".bashrc"), filepath.Join(homeDir, ".bashrc"))
+	os.Symlink(filepath.Join(homeDir, "missing"), filepath.Join(homeDir, ".other"))
+	os.MkdirAll(filepath.Join(dotfilesDirPath, ".config"), 0755)
+	os.MkdirAll(filepath.Join(homeDir, ".config"), 0755)
+	os.Symlink(filepath.Join(dotfilesDirPath, ".config", "removed"), filepath.Join(homeDir, ".config", "removed"))
+
+	dangling, err := FindDanglingDotfiles(dotfilesDirPath, homeDir)
+	if err != nil {
+		t.Fatalf("FindDanglingDotfiles func returned an error: %s", err)
+	}
+	if expected := []string{".bashrc", ".config/removed"}; !reflect.DeepEqual(dangling, expected) {
+		t.Errorf("FindDanglingDotfiles func returned wrong dotfiles: got %#v want %#v", dangling, expected)
+	}
+}
+
+func TestUnlinkDotfiles(t *testing.T) {
+	cases := []struct {
+		Paths    []string
+		Remove   bool
+		Expected []string
+	}{
+		{[]string{".vimrc"}, false, []string{".vimrc"}},
+		{[]string{".vimrc"}, true, []string{".vimrc"}},
+		{[]string{".config"}, false, []string{".config/nvim/init.lua"}},
+		{[]string{""}, true, []string{".config/nvim/init.lua", ".vim", ".vimrc"}},
+	}
+	for _, tc := range cases {
+		dotfilesDirPath := t.TempDir()
+		homeDir := t.TempDir()
+
+		os.WriteFile(filepath.Join(dotfilesDirPath, ".vimrc"), []byte("vimrc"), 0644)
+		os.MkdirAll(filepath.Join(dotfilesDirPath, ".vim", "colors"), 0755)
+		os.WriteFile(filepath.Join(dotfilesDirPath, ".vim", "colors", "theme.vim"), []byte("theme"), 0644)
+		os.MkdirAll(filepath.Join(dotfilesDirPath, ".config", "nvim"), 0755)
+		os.WriteFile(filepath.Join(dotfilesDirPath, ".config", "nvim", "init.lua"), []byte("init"), 0644)
+		if _, err := LinkDotfiles(dotfilesDirPath, homeDir, LinkOptions{Mode: LinkFile, Conflict: ConflictSkip}); err != nil {
+			t.Fatalf("LinkDotfiles func returned an error: %s", err)
+		}
+		os.RemoveAll(filepath.Join(homeDir, ".vim"))
+		os.Symlink(filepath.Join(dotfilesDirPath, ".vim"), filepath.Join(homeDir, ".vim"))
+
+		unlinked, err := UnlinkDotfiles(tc.Paths, dotfilesDirPath, homeDir, tc.Remove)
+		if err != nil {
+			t.Fatalf("UnlinkDotfiles func returned an error: %s", err)
+		}
+		if !reflect.DeepEqual(unlinked, tc.Expected) {
+			t.Errorf("UnlinkDotfiles func returned wrong dotfiles for %#v: got %#v want %#v", tc.Paths, unlinked, tc.Expected)
+		}
+		for _, name := range unlinked {
+			fi, err := os.Lstat(filepath.Join(homeDir, name))
+			if err != nil || fi.Mode()&os.ModeSymlink != 0 {
+				t.Errorf("UnlinkDotfiles func left %s as a symlink", name)
+			}
+			if _, err := os.Lstat(filepath.Join(dotfilesDirPath, name)); tc.Remove != os.IsNotExist(err) {
+				t.Errorf("UnlinkDotfiles func with remove %t returned wrong dotfiles directory state for %s", tc.Remove, name)
+			}
+		}
+	}
+}
+
+func TestUnlinkDotfilesNotLinked(t *testing.T) {
+	dotfilesDirPath := t.TempDir()
+	homeDir := t.TempDir()
+	os.WriteFile(filepath.Join(homeDir, ".vimrc"), []byte("vimrc"), 0644)
+
+	for _, path := range []string{".vimrc", ".missing"} {
+		if _, err := UnlinkDotfiles([]string{path}, dotfilesDirPath, homeDir, false); !errors.Is(err, ErrNotLinkedDotfile) {
+			t.Errorf("UnlinkDotfiles func returned wrong error for %s: got %#v want %#v", path, err, ErrNotLinkedDotfile)
+		}
+	}
+}
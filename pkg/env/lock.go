@@ -0,0 +1,271 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
+	"github.com/thylong/ian/pkg/log"
+	pm "github.com/thylong/ian/pkg/package-managers"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LockPath is the path of env.lock, next to env.yml.
+var LockPath = filepath.Join(config.IanConfigPath, "env.lock")
+
+// floatingPackageManagers can't install a given version of a package: their
+// locked packages are installed at their latest version, then checked.
+var floatingPackageManagers = map[string]bool{"brew": true, "cask": true}
+
+// LockedPackages contains the versions of the packages per package manager.
+type LockedPackages map[string]map[string]string
+
+// Lock records the installed versions of the packages of env.yml per
+// platform (os/arch).
+type Lock struct {
+	Platforms map[string]LockedPackages `yaml:"platforms"`
+}
+
+// LockMismatchError is returned when an installed version doesn't match
+// env.lock.
+type LockMismatchError struct {
+	PackageManager string
+	Package        string
+	Locked         string
+	Installed      string
+}
+
+func (e *LockMismatchError) Error() string {
+	installed := e.Installed
+	if installed == "" {
+		installed = "not installed"
+	}
+	return fmt.Sprintf("%s %s: locked %s, installed %s", e.PackageManager, e.Package, e.Locked, installed)
+}
+
+// Is makes LockMismatchError match ErrLockMismatch.
+func (e *LockMismatchError) Is(target error) bool {
+	return target == ErrLockMismatch
+}
+
+// Platform returns the platform of the packages locked on this machine.
+func Platform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// LoadLock returns the Lock stored at path, or ErrNoLock if there is none.
+func LoadLock(path string) (*Lock, error) {
+	content, err := afero.ReadFile(AppFs, path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoLock
+	}
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{}
+	if err = yaml.Unmarshal(content, lock); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return lock, nil
+}
+
+// Save writes the lock at path.
+func (l *Lock) Save(path string) error {
+	content, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return afero.WriteFile(AppFs, path, content, 0644)
+}
+
+// UpdateLock records in env.lock the installed versions of the packages of
+// env.yml for the current platform. The versions of a package manager that
+// can't be queried are kept as they were.
+func UpdateLock() error {
+	lock, err := LoadLock(LockPath)
+	if errors.Is(err, ErrNoLock) {
+		lock = &Lock{}
+	} else if err != nil {
+		return err
+	}
+	if lock.Platforms == nil {
+		lock.Platforms = make(map[string]LockedPackages)
+	}
+	previous := lock.Platforms[Platform()]
+	locked := make(LockedPackages)
+
+	packageManagers := config.Vipers["env"].AllKeys()
+	sort.Strings(packageManagers)
+	for _, name := range packageManagers {
+		if !pm.IsSupportedPackageManager(name) || !pm.GetPackageManager(name).IsInstalled() {
+			continue
+		}
+		declared, err := GetDeclaredPackages(name)
+		if err != nil {
+			return err
+		}
+		if len(declared) == 0 {
+			continue
+		}
+		versions, err := pm.GetPackageManager(name).InstalledVersions()
+		if err != nil {
+			log.Warningf("Keeping the locked %s packages: %s\n", name, err)
+			if previous[name] != nil {
+				locked[name] = previous[name]
+			}
+			continue
+		}
+		locked[name] = LockPackages(name, declared, versions)
+	}
+	lock.Platforms[Platform()] = locked
+	return lock.Save(LockPath)
+}
+
+// LockPackages returns the installed version of the declared packages of a
+// package manager, by their installed name. Packages not installed are left
+// out.
+func LockPackages(packageManager string, declared []string, versions map[string]string) map[string]string {
+	installed := make(map[string]bool)
+	for name := range versions {
+		installed[name] = true
+	}
+	locked := make(map[string]string)
+	for _, entry := range declared {
+		if name, ok := installedName(packageManager, entry, installed); ok {
+			locked[name] = versions[name]
+		}
+	}
+	return locked
+}
+
+// InstallLockedPackages installs the versions of env.lock for the current
+// platform, checks the installed versions match them and returns the outcome
+// of every package, a mismatch being a failure. It fails before installing
+// anything if env.yml declares packages env.lock doesn't contain.
+func InstallLockedPackages() (outcomes []PackageOutcome, err error) {
+	lock, err := LoadLock(LockPath)
+	if err != nil {
+		return nil, err
+	}
+	locked, ok := lock.Platforms[Platform()]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrNoLock, Platform())
+	}
+	if err = checkLockedPackages(locked); err != nil {
+		return nil, err
+	}
+
+	for _, name := range sortedKeys(locked) {
+		log.Infof("Installing locked %s packages...\n", name)
+		outcomes = append(outcomes, installLockedPackages(pm.GetPackageManager(name), locked[name])...)
+	}
+	return outcomes, nil
+}
+
+// installLockedPackages installs the locked packages of a package manager
+// whose installed version differs, then checks the installed versions.
+func installLockedPackages(packageManager pm.PackageManager, locked map[string]string) (outcomes []PackageOutcome) {
+	name := packageManager.GetName()
+	var packages []string
+	for packageName := range locked {
+		packages = append(packages, packageName)
+	}
+	sort.Strings(packages)
+	versions, err := packageManager.InstalledVersions()
+	if err != nil {
+		for _, packageName := range packages {
+			outcomes = append(outcomes, NewPackageOutcome(name, packageName, err))
+		}
+		return outcomes
+	}
+
+	var entries []string
+	packageNames := make(map[string]string)
+	for _, packageName := range packages {
+		if versions[packageName] == locked[packageName] {
+			continue
+		}
+		entry := pm.PackageSpec{Name: packageName, Constraints: []pm.Constraint{{Operator: "=", Version: locked[packageName]}}}.String()
+		if floatingPackageManagers[name] {
+			entry = packageName
+		}
+		entries = append(entries, entry)
+		packageNames[entry] = packageName
+	}
+	errs := make(map[string]error)
+	if len(entries) > 0 {
+		for entry, err := range installBatch(packageManager, entries) {
+			errs[packageNames[entry]] = err
+		}
+	}
+
+	installedVersions, err := packageManager.InstalledVersions()
+	for _, packageName := range packages {
+		outcome := NewPackageOutcome(name, packageName, errs[packageName])
+		switch {
+		case outcome.State == PackageFailed:
+		case err != nil:
+			outcome = NewPackageOutcome(name, packageName, err)
+		case dryrun.Enabled() && versions[packageName] != locked[packageName]:
+			// The install was only recorded, there's no version to check.
+		case installedVersions[packageName] != locked[packageName]:
+			outcome = NewPackageOutcome(name, packageName, &LockMismatchError{PackageManager: name, Package: packageName, Locked: locked[packageName], Installed: installedVersions[packageName]})
+		case versions[packageName] == locked[packageName]:
+			outcome.State = PackagePresent
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes
+}
+
+// checkLockedPackages returns ErrLockOutdated if a package of env.yml isn't
+// locked. Package managers neither locked nor installed are left out, as
+// env.yml may declare packages of other platforms.
+func checkLockedPackages(locked LockedPackages) error {
+	var unlocked []string
+	packageManagers := config.Vipers["env"].AllKeys()
+	sort.Strings(packageManagers)
+	for _, name := range packageManagers {
+		if !pm.IsSupportedPackageManager(name) || (locked[name] == nil && !pm.GetPackageManager(name).IsInstalled()) {
+			continue
+		}
+		declared, err := GetDeclaredPackages(name)
+		if err != nil {
+			return err
+		}
+		installed := make(map[string]bool)
+		for packageName := range locked[name] {
+			installed[packageName] = true
+		}
+		for _, entry := range declared {
+			if _, ok := installedName(name, entry, installed); !ok {
+				unlocked = append(unlocked, fmt.Sprintf("%s (%s)", entry, name))
+			}
+		}
+	}
+	if len(unlocked) > 0 {
+		return fmt.Errorf("%w: %s", ErrLockOutdated, strings.Join(unlocked, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package env
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestLockPackages(t *testing.T) {
+	declared := []string{"git", "node@20", "jq"}
+	versions := map[string]string{"git": "2.41.0", "node@20": "20.5.1", "pcre2": "10.42"}
+	expected := map[string]string{"git": "2.41.0", "node@20": "20.5.1"}
+	if locked := LockPackages("brew", declared, versions); !reflect.DeepEqual(locked, expected) {
+		t.Errorf("LockPackages func returned wrong versions: got %#v want %#v", locked, expected)
+	}
+
+	// node isn't the node@20 formula.
+	if locked := LockPackages("brew", []string{"node@20"}, map[string]string{"node": "22.1.0"}); len(locked) != 0 {
+		t.Errorf("LockPackages func locked another formula: got %#v want none", locked)
+	}
+
+	declared = []string{"Django>=4", "requests@2.31"}
+	versions = map[string]string{"django": "4.2", "requests": "2.31.0"}
+	expected = map[string]string{"django": "4.2", "requests": "2.31.0"}
+	if locked := LockPackages("pip", declared, versions); !reflect.DeepEqual(locked, expected) {
+		t.Errorf("LockPackages func returned wrong versions: got %#v want %#v", locked, expected)
+	}
+}
+
+func TestLockSaveAndLoad(t *testing.T) {
+	AppFs = afero.NewMemMapFs()
+	defer func() { AppFs = afero.NewOsFs() }()
+
+	if _, err := LoadLock("/env.lock"); !errors.Is(err, ErrNoLock) {
+		t.Errorf("LoadLock func returned wrong error: got %v want %v", err, ErrNoLock)
+	}
+
+	lock := &Lock{Platforms: map[string]LockedPackages{
+		"darwin/arm64": {"brew": {"git": "2.41.0"}},
+		"linux/amd64":  {"apt": {"git": "1:2.39.2-1.1"}},
+	}}
+	if err := lock.Save("/env.lock"); err != nil {
+		t.Fatalf("Lock.Save func failed: %s", err)
+	}
+	loaded, err := LoadLock("/env.lock")
+	if err != nil {
+		t.Fatalf("LoadLock func failed: %s", err)
+	}
+	if !reflect.DeepEqual(loaded, lock) {
+		t.Errorf("LoadLock func returned wrong lock: got %#v want %#v", loaded, lock)
+	}
+}
+
+func TestInstallLockedPackages(t *testing.T) {
+	pip := registerFakePackageManager(t, "pip")
+	pip.versions["requests"] = "2.0.0"
+	pip.versions["black"] = "23.1"
+	outcomes := installLockedPackages(pip, map[string]string{"requests": "2.31.0", "black": "23.1", "flake8": "6.1.0"})
+	expected := []PackageOutcome{
+		{PackageManager: "pip", Package: "black", State: PackagePresent},
+		{PackageManager: "pip", Package: "flake8", State: PackageInstalled},
+		{PackageManager: "pip", Package: "requests", State: PackageInstalled},
+	}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Errorf("installLockedPackages func returned wrong outcomes: got %#v want %#v", outcomes, expected)
+	}
+	if expected := []string{"flake8@6.1.0", "requests@2.31.0"}; pip.batches != 1 || !reflect.DeepEqual(pip.installed, expected) {
+		t.Errorf("installLockedPackages func installed wrong packages: got %#v in %d commands want %#v in 1", pip.installed, pip.batches, expected)
+	}
+
+	// A failing batch is installed again package by package.
+	npm := registerFakePackageManager(t, "npm")
+	npm.failing = map[string]bool{"eslint@8.50.0": true}
+	outcomes = installLockedPackages(npm, map[string]string{"eslint": "8.50.0", "typescript": "5.2.2"})
+	if outcomes[0].State != PackageFailed || outcomes[1].State != PackageInstalled {
+		t.Errorf("installLockedPackages func returned wrong outcomes: got %#v", outcomes)
+	}
+	if expected := []string{"typescript@5.2.2"}; !reflect.DeepEqual(npm.installed, expected) {
+		t.Errorf("installLockedPackages func installed wrong packages: got %#v want %#v", npm.installed, expected)
+	}
+
+	// Brew can't install a given version, the installed one doesn't match.
+	brew := registerFakePackageManager(t, "brew")
+	outcomes = installLockedPackages(brew, map[string]string{"git": "2.41.0"})
+	mismatchErr := &LockMismatchError{PackageManager: "brew", Package: "git", Locked: "2.41.0", Installed: "latest"}
+	expected = []PackageOutcome{{PackageManager: "brew", Package: "git", State: PackageFailed, Error: mismatchErr.Error()}}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Errorf("installLockedPackages func returned wrong outcomes: got %#v want %#v", outcomes, expected)
+	}
+	if expected := []string{"git"}; !reflect.DeepEqual(brew.installed, expected) {
+		t.Errorf("installLockedPackages func installed wrong packages: got %#v want %#v", brew.installed, expected)
+	}
+
+	// Locked apt versions are installed verbatim, epoch included.
+	apt := registerFakePackageManager(t, "apt")
+	outcomes = installLockedPackages(apt, map[string]string{"git": "1:2.39.2-1.1"})
+	expected = []PackageOutcome{{PackageManager: "apt", Package: "git", State: PackageInstalled}}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Errorf("installLockedPackages func returned wrong outcomes: got %#v want %#v", outcomes, expected)
+	}
+	if expected := []string{"git@1:2.39.2-1.1"}; !reflect.DeepEqual(apt.installed, expected) {
+		t.Errorf("installLockedPackages func installed wrong packages: got %#v want %#v", apt.installed, expected)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thylong/ian/pkg/config"
+	pm "github.com/thylong/ian/pkg/package-managers"
+)
+
+// GetDeclaredPackages returns the packages of a package manager declared in
+// env.yml. See parseDeclaredPackages for the accepted entries.
+func GetDeclaredPackages(packageManager string) ([]string, error) {
+	packages, err := parseDeclaredPackages(config.Vipers["env"].Get(packageManager))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", packageManager, err)
+	}
+	return packages, nil
+}
+
+// parseDeclaredPackages returns the packages of an env.yml list. Entries are
+// either strings (node, node@20, node>=18,<21) or mappings with a name and a
+// version (name: node, version: ">=18,<21"), returned as strings.
+func parseDeclaredPackages(value interface{}) (packages []string, err error) {
+	if value == nil {
+		return nil, nil
+	}
+	entries, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: packages must be a list", pm.ErrInvalidPackageSpec)
+	}
+	for _, entry := range entries {
+		var spec pm.PackageSpec
+		switch entry := entry.(type) {
+		case string:
+			spec, err = pm.ParsePackageSpec(entry)
+		case map[string]interface{}:
+			spec, err = pm.NewPackageSpec(stringOf(entry["name"]), stringOf(entry["version"]))
+		case map[interface{}]interface{}:
+			spec, err = pm.NewPackageSpec(stringOf(entry["name"]), stringOf(entry["version"]))
+		default:
+			spec, err = pm.ParsePackageSpec(fmt.Sprint(entry))
+		}
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, spec.String())
+	}
+	return packages, nil
+}
+
+// stringOf returns a field of a mapping entry as a string, YAML parsing
+// versions such as 20 as numbers.
+func stringOf(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// packageName returns the name of a package of env.yml, without its version.
+func packageName(entry string) string {
+	if spec, err := pm.ParsePackageSpec(entry); err == nil {
+		return spec.Name
+	}
+	return entry
+}
+
+// versionedNamePackageManagers install the versions of a package under their
+// own name (brew node@20), which the unversioned package (node) doesn't
+// provide.
+var versionedNamePackageManagers = map[string]bool{"brew": true, "cask": true}
+
+// installedName returns the name under which a package of env.yml is
+// installed: the entry itself for versioned names (brew node@20), otherwise
+// the name without version. Names are compared case-insensitively.
+func installedName(packageManager string, entry string, installed map[string]bool) (string, bool) {
+	candidates := []string{entry, packageName(entry)}
+	if spec, err := pm.ParsePackageSpec(entry); err == nil && versionedNamePackageManagers[packageManager] {
+		if _, ok := spec.ExactVersion(); ok {
+			candidates = candidates[:1]
+		}
+	}
+	for _, candidate := range candidates {
+		for name := range installed {
+			if strings.EqualFold(name, candidate) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// MissingPackages returns the declared packages of a package manager that
+// aren't installed, see installedName.
+func MissingPackages(packageManager string, declared []string, installed []string) (missing []string) {
+	installedSet := make(map[string]bool)
+	for _, name := range installed {
+		installedSet[name] = true
+	}
+	for _, entry := range declared {
+		if _, ok := installedName(packageManager, entry, installedSet); !ok {
+			missing = append(missing, entry)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// ValidatePackages returns the errors of the packages of env.yml that can't
+// be parsed or installed with their version constraint, sorted by package
+// manager.
+func ValidatePackages() (errs []error) {
+	packageManagers := config.Vipers["env"].AllKeys()
+	sort.Strings(packageManagers)
+	for _, name := range packageManagers {
+		if !pm.IsSupportedPackageManager(name) {
+			continue
+		}
+		packages, err := GetDeclaredPackages(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, validatePackages(pm.GetPackageManager(name), packages)...)
+	}
+	return errs
+}
+
+// validatePackages returns the errors of the packages the package manager
+// can't install.
+func validatePackages(packageManager pm.PackageManager, packages []string) (errs []error) {
+	for _, entry := range packages {
+		spec, err := pm.ParsePackageSpec(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", packageManager.GetName(), err))
+			continue
+		}
+		if _, err = packageManager.PackageArgs(spec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,90 @@
+package env
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	pm "github.com/thylong/ian/pkg/package-managers"
+)
+
+func TestParseDeclaredPackages(t *testing.T) {
+	value := []interface{}{
+		"git",
+		"node@20",
+		"typescript>=4,<6",
+		map[string]interface{}{"name": "black", "version": "23.1"},
+		map[string]interface{}{"name": "rails", "version": ">= 7, < 8"},
+		map[interface{}]interface{}{"name": "python", "version": 3.11},
+		map[string]interface{}{"name": "jq"},
+	}
+	packages, err := parseDeclaredPackages(value)
+	if err != nil {
+		t.Fatalf("parseDeclaredPackages func failed: %s", err)
+	}
+	expected := []string{"git", "node@20", "typescript>=4,<6", "black@23.1", "rails>=7,<8", "python@3.11", "jq"}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Errorf("parseDeclaredPackages func returned wrong packages: got %#v want %#v", packages, expected)
+	}
+
+	for _, value := range []interface{}{"git", []interface{}{"node@"}, []interface{}{map[string]interface{}{"version": "1"}}} {
+		if _, err := parseDeclaredPackages(value); !errors.Is(err, pm.ErrInvalidPackageSpec) {
+			t.Errorf("parseDeclaredPackages(%#v) returned wrong error: got %v want %v", value, err, pm.ErrInvalidPackageSpec)
+		}
+	}
+}
+
+func TestValidatePackages(t *testing.T) {
+	errs := validatePackages(pm.GetPackageManager("brew"), []string{"git", "node@20", "node>=20", "python@"})
+	if len(errs) != 2 {
+		t.Fatalf("validatePackages func returned wrong errors: got %v want 2 errors", errs)
+	}
+	if !errors.Is(errs[0], pm.ErrUnsupportedConstraint) {
+		t.Errorf("validatePackages func returned wrong error: got %v want %v", errs[0], pm.ErrUnsupportedConstraint)
+	}
+	if !errors.Is(errs[1], pm.ErrInvalidPackageSpec) {
+		t.Errorf("validatePackages func returned wrong error: got %v want %v", errs[1], pm.ErrInvalidPackageSpec)
+	}
+}
+
+func TestIndexOfPackage(t *testing.T) {
+	packages := []string{"git", "node@20", "Wget"}
+	for entry, expected := range map[string]int{"node@22": 1, "node": 1, "wget": 2, "jq": -1} {
+		if i := indexOfPackage(packages, entry); i != expected {
+			t.Errorf("indexOfPackage(%q) returned wrong index: got %d want %d", entry, i, expected)
+		}
+	}
+}
+
+func TestInstalledName(t *testing.T) {
+	cases := []struct {
+		PackageManager string
+		Entry          string
+		Installed      string
+		Expected       string
+		Found          bool
+	}{
+		// brew versioned formulae are installed under their versioned name.
+		{"brew", "node@20", "node@20", "node@20", true},
+		{"brew", "node", "node@20", "", false},
+		// The unversioned formula is another version (22.x).
+		{"brew", "node@20", "node", "", false},
+		{"pip", "requests@2.31", "requests", "requests", true},
+		{"pip", "requests>=2,<3", "requests", "requests", true},
+		{"brew", "wget", "Wget", "Wget", true},
+	}
+	for _, tc := range cases {
+		installed := map[string]bool{tc.Installed: true}
+		if name, ok := installedName(tc.PackageManager, tc.Entry, installed); name != tc.Expected || ok != tc.Found {
+			t.Errorf("%s installedName(%q) with %s installed returned wrong name: got (%q, %t) want (%q, %t)",
+				tc.PackageManager, tc.Entry, tc.Installed, name, ok, tc.Expected, tc.Found)
+		}
+	}
+}
+
+func TestMissingPackages(t *testing.T) {
+	missing := MissingPackages("brew", []string{"wget", "git", "Htop", "node@20"}, []string{"git", "htop", "node"})
+	if expected := []string{"node@20", "wget"}; !reflect.DeepEqual(missing, expected) {
+		t.Errorf("MissingPackages func returned wrong packages: got %#v want %#v", missing, expected)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thylong/ian/pkg/command"
+	"github.com/thylong/ian/pkg/config"
+)
+
+// RestoreReportPath is the path of the report of the last restore.
+var RestoreReportPath = filepath.Join(config.IanConfigPath, "restore-report.json")
+
+// PackageState is the outcome of the restore of a package.
+type PackageState string
+
+const (
+	// PackageInstalled means the package has been installed.
+	PackageInstalled PackageState = "installed"
+	// PackageUpgraded means the package was already installed and has been
+	// upgraded.
+	PackageUpgraded PackageState = "upgraded"
+	// PackagePresent means the package was already installed.
+	PackagePresent PackageState = "present"
+	// PackageFailed means the package couldn't be installed.
+	PackageFailed PackageState = "failed"
+	// PackageSkipped means the package hasn't been installed, e.g. because
+	// its package manager isn't installed.
+	PackageSkipped PackageState = "skipped"
+)
+
+// PackageOutcome is the outcome of the restore of a package.
+type PackageOutcome struct {
+	PackageManager string       `json:"package_manager"`
+	Package        string       `json:"package"`
+	State          PackageState `json:"state"`
+	Error          string       `json:"error,omitempty"`
+	// Stderr is the output on stderr of the failing install command.
+	Stderr string `json:"stderr,omitempty"`
+}
+
+// NewPackageOutcome returns the outcome of a package whose install returned
+// err, with the stderr of the failing command if any.
+func NewPackageOutcome(packageManager string, packageName string, err error) PackageOutcome {
+	outcome := PackageOutcome{PackageManager: packageManager, Package: packageName, State: PackageInstalled}
+	if err != nil {
+		outcome.State = PackageFailed
+		outcome.Error = err.Error()
+		var execErr *command.ExecError
+		if errors.As(err, &execErr) {
+			outcome.Stderr = execErr.Stderr
+		}
+	}
+	return outcome
+}
+
+// RestoreReport is the outcome of every package of a restore.
+type RestoreReport struct {
+	Packages []PackageOutcome `json:"packages"`
+}
+
+// Count returns the number of packages in the given state.
+func (r RestoreReport) Count(state PackageState) (count int) {
+	for _, outcome := range r.Packages {
+		if outcome.State == state {
+			count++
+		}
+	}
+	return count
+}
+
+// HasFailures returns true if a package couldn't be installed.
+func (r RestoreReport) HasFailures() bool {
+	return r.Count(PackageFailed) > 0
+}
+
+// sortOutcomes sorts the outcomes by package manager and package.
+func sortOutcomes(outcomes []PackageOutcome) {
+	sort.SliceStable(outcomes, func(i, j int) bool {
+		if outcomes[i].PackageManager != outcomes[j].PackageManager {
+			return outcomes[i].PackageManager < outcomes[j].PackageManager
+		}
+		return outcomes[i].Package < outcomes[j].Package
+	})
+}
+
+// PrintRestoreReport writes the outcome of every package followed by a
+// summary. Failures are shown with the last line of their stderr.
+func PrintRestoreReport(w io.Writer, report RestoreReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MANAGER\tPACKAGE\tRESULT")
+	for _, outcome := range report.Packages {
+		result := string(outcome.State)
+		if outcome.Error != "" {
+			result = fmt.Sprintf("%s: %s", result, outcome.Error)
+		}
+		if lines := strings.Split(outcome.Stderr, "\n"); outcome.Stderr != "" {
+			result = fmt.Sprintf("%s (%s)", result, lines[len(lines)-1])
+		}
+		packageName := outcome.Package
+		if packageName == "" {
+			packageName = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", outcome.PackageManager, packageName, result)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d installed, %d upgraded, %d already present, %d failed, %d skipped\n",
+		report.Count(PackageInstalled), report.Count(PackageUpgraded), report.Count(PackagePresent), report.Count(PackageFailed), report.Count(PackageSkipped))
+}
+
+// PrintRestoreReportJSON writes the report as JSON.
+func PrintRestoreReportJSON(w io.Writer, report RestoreReport) error {
+	if report.Packages == nil {
+		report.Packages = []PackageOutcome{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// WriteRestoreReport writes the report as JSON at path.
+func WriteRestoreReport(path string, report RestoreReport) error {
+	file, err := AppFs.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return PrintRestoreReportJSON(file, report)
+}
@@ -15,32 +15,60 @@
 package env
 
 import (
-	"io/ioutil"
+	"fmt"
 	"os"
-	"os/exec"
 	"os/user"
-	"path/filepath"
-	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/thylong/ian/pkg/command"
 	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
 	"github.com/thylong/ian/pkg/log"
 	pm "github.com/thylong/ian/pkg/package-managers"
+	"github.com/thylong/ian/pkg/repo"
 )
 
-// Restore installs Ian and configuration Ian's environment.
-func Restore(OSPackageManager pm.PackageManager) {
+// InstallMode sets what happens to the packages already installed.
+type InstallMode string
+
+const (
+	// InstallMissing installs the missing packages only, and the ones whose
+	// installed version doesn't satisfy env.yml.
+	InstallMissing InstallMode = "missing"
+	// InstallReinstall installs every package, even if already installed.
+	InstallReinstall InstallMode = "reinstall"
+	// InstallUpgrade installs the missing packages and upgrades the others.
+	InstallUpgrade InstallMode = "upgrade"
+)
+
+// RestoreOptions sets how Restore installs the environment.
+type RestoreOptions struct {
+	// Conflict is the dotfiles conflict strategy, see GetConflictStrategy.
+	Conflict string
+	// Frozen installs the versions of env.lock, a mismatch being a failure.
+	Frozen bool
+	// Mode sets what happens to the packages already installed.
+	Mode InstallMode
+}
+
+// Restore installs Ian and configuration Ian's environment, and returns the
+// outcome of every package. Unless frozen, env.lock is updated with the
+// installed versions.
+func Restore(OSPackageManager pm.PackageManager, opts RestoreOptions) (report RestoreReport, err error) {
 	if _, err := os.Stat(OSPackageManager.GetExecPath()); err != nil {
 		log.Infoln("Installing OS package manager...")
 		if err = OSPackageManager.Setup(); err != nil {
 			log.Errorln("Missing OS package manager !")
-			return
+			return report, err
 		}
 	}
 
 	SetupDotFiles(
 		config.Vipers["config"].GetStringMapString("dotfiles")["repository"],
 		config.DotfilesDirPath,
+		opts.Conflict,
 	)
 
 	// Refresh the configuration in case the imported dotfiels contains ian configuration
@@ -57,52 +85,267 @@ Enter your choice`)
 		config.CreateEnvFileWithPreset(in)
 	}
 
-	packageManagers := config.Vipers["env"].AllKeys()
-	for _, packageManager := range packageManagers {
-		packages := config.Vipers["env"].GetStringSlice(packageManager)
-		InstallPackages(pm.GetPackageManager(packageManager), packages)
+	if opts.Frozen {
+		if report.Packages, err = InstallLockedPackages(); err != nil {
+			return report, err
+		}
+	} else {
+		if report.Packages, err = RestorePackages(config.Vipers["env"].AllKeys(), opts.Mode); err != nil {
+			return report, err
+		}
+		if err := UpdateLock(); err != nil {
+			log.Errorf("Cannot update env.lock: %s\n", err)
+		}
 	}
+
+	SyncRepositories()
+	return report, nil
 }
 
-// SetupDotFiles ask and retrieve a dotfiles repository.
-func SetupDotFiles(dotfilesRepository string, dotfilesDirPath string) {
-	usr, _ := user.Current()
-	if _, err := os.Stat(usr.HomeDir + "/.dotfiles"); err != nil && dotfilesRepository != "" {
-		termCmd := exec.Command("git", "clone", "-v", "https://github.com/"+dotfilesRepository+".git", dotfilesDirPath)
-		command.ExecuteInteractiveCommand(termCmd)
+// PlanRestore returns the package managers to restore in stages: the package
+// managers of a stage only depend on the ones of the previous stages, so they
+// can be restored concurrently. Dependencies that aren't restored are ignored.
+func PlanRestore(packageManagers []string) (stages [][]string, err error) {
+	pending := make(map[string]bool)
+	for _, name := range packageManagers {
+		pending[name] = true
+	}
+	for len(pending) > 0 {
+		var stage []string
+		for name := range pending {
+			ready := true
+			for _, dependency := range pm.GetPackageManager(name).DependsOn() {
+				ready = ready && !pending[dependency]
+			}
+			if ready {
+				stage = append(stage, name)
+			}
+		}
+		if len(stage) == 0 {
+			var cycle []string
+			for name := range pending {
+				cycle = append(cycle, name)
+			}
+			sort.Strings(cycle)
+			return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, ", "))
+		}
+		sort.Strings(stage)
+		for _, name := range stage {
+			delete(pending, name)
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
 
-		re := regexp.MustCompile(".git$")
+// RestorePackages installs the packages of env.yml of the given package
+// managers, stage by stage (see PlanRestore), and returns their outcome. The
+// package managers of a stage run concurrently, their output being prefixed
+// by their name. See InstallPackages for mode.
+func RestorePackages(packageManagers []string, mode InstallMode) (outcomes []PackageOutcome, err error) {
+	var supported []string
+	for _, name := range packageManagers {
+		if !pm.IsSupportedPackageManager(name) {
+			outcomes = append(outcomes, PackageOutcome{PackageManager: name, State: PackageSkipped, Error: ErrUnsupportedPackageManager.Error()})
+			continue
+		}
+		supported = append(supported, name)
+	}
+	stages, err := PlanRestore(supported)
+	if err != nil {
+		return nil, err
+	}
 
-		files, _ := ioutil.ReadDir(filepath.Join(usr.HomeDir, "/.dotfiles"))
-		for _, f := range files {
-			if re.MatchString(f.Name()) {
+	var mu sync.Mutex
+	for _, stage := range stages {
+		var wg sync.WaitGroup
+		for _, name := range stage {
+			packages, err := GetDeclaredPackages(name)
+			if err != nil {
+				mu.Lock()
+				outcomes = append(outcomes, NewPackageOutcome(name, "", err))
+				mu.Unlock()
 				continue
 			}
+			packageManager := pm.GetPackageManager(name)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				command.SetOutputPrefix(packageManager.GetExecPath(), fmt.Sprintf("[%s] ", packageManager.GetName()))
+				defer command.SetOutputPrefix(packageManager.GetExecPath(), "")
+				packageOutcomes := InstallPackages(packageManager, packages, mode)
+				mu.Lock()
+				outcomes = append(outcomes, packageOutcomes...)
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+	}
+	sortOutcomes(outcomes)
+	return outcomes, nil
+}
 
-			if _, err := os.Stat(filepath.Join(usr.HomeDir, f.Name())); err != nil {
-				if err := os.Symlink(
-					filepath.Join(usr.HomeDir, ".dotfiles", f.Name()),
-					filepath.Join(usr.HomeDir, f.Name()),
-				); err != nil {
-					log.Errorln(err)
-				}
-			}
+// SyncRepositories clones and fetches the repositories listed in config.yml.
+func SyncRepositories() {
+	manifest, err := config.GetRepositoriesManifest()
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Cannot read the repositories manifest: %s\n", err)
+		return
+	}
+	if len(manifest) == 0 {
+		log.Infoln("Skipping repositories configuration.")
+		return
+	}
+	log.Infoln("Synchronizing repositories...")
+	results, extras, err := repo.Sync(0)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	repo.PrintResults(os.Stdout, results)
+	repo.PrintExtras(os.Stdout, extras)
+}
+
+// SetupDotFiles ask and retrieve a dotfiles repository.
+// Existing files are handled according to the conflict strategy.
+func SetupDotFiles(dotfilesRepository string, dotfilesDirPath string, conflict string) {
+	usr, _ := user.Current()
+	if _, err := os.Stat(usr.HomeDir + "/.dotfiles"); err != nil && dotfilesRepository != "" {
+		remote, err := GetDotfilesRemote(dotfilesRepository)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		if err := Git.Clone(remote.HTTPSURL(), dotfilesDirPath); err != nil {
+			log.Errorln(err)
+			return
+		}
+		// In dry run, the clone was recorded and there's nothing to link yet.
+		if dryrun.Record("symlink", "the dotfiles of %s into %s", dotfilesDirPath, usr.HomeDir) {
+			return
+		}
+
+		opts, err := GetLinkOptions(conflict)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		report, err := LinkDotfiles(dotfilesDirPath, usr.HomeDir, opts)
+		if err != nil {
+			log.Errorln(err)
 		}
+		PrintLinkReport(report)
 	} else {
 		log.Infoln("Skipping dotfiles configuration.")
 	}
 }
 
-// InstallPackages installs listed CLI packages.
-func InstallPackages(PackageManager pm.PackageManager, packages []string) {
+// InstallPackages installs listed CLI packages in a single command and
+// returns their outcome. If it fails, they are installed one by one to find
+// out the failing ones. Packages of a package manager that isn't installed
+// are skipped.
+//
+// Packages already installed at a version satisfying their constraint are
+// left as they are, unless mode is InstallReinstall or InstallUpgrade.
+func InstallPackages(PackageManager pm.PackageManager, packages []string, mode InstallMode) (outcomes []PackageOutcome) {
 	if len(packages) == 0 {
-		return
+		return nil
+	}
+	name := PackageManager.GetName()
+	if !PackageManager.IsInstalled() {
+		for _, packageToInstall := range packages {
+			outcomes = append(outcomes, PackageOutcome{PackageManager: name, Package: packageToInstall, State: PackageSkipped, Error: fmt.Sprintf("%s is not installed", name)})
+		}
+		return outcomes
+	}
+
+	versions, err := PackageManager.InstalledVersions()
+	if err != nil {
+		log.Warningf("%s\n", err)
+	}
+	var toInstall []string
+	toUpgrade := make(map[string]string)
+	for _, packageToInstall := range packages {
+		installed, ok := installedVersion(name, packageToInstall, versions)
+		switch {
+		case !ok || mode == InstallReinstall:
+			toInstall = append(toInstall, packageToInstall)
+		case mode == InstallUpgrade:
+			toUpgrade[packageToInstall] = installed
+		default:
+			outcomes = append(outcomes, PackageOutcome{PackageManager: name, Package: packageToInstall, State: PackagePresent})
+		}
+	}
+
+	if len(toInstall) > 0 {
+		log.Infof("Installing %s packages...\n", name)
+		outcomes = append(outcomes, installPackages(PackageManager, toInstall)...)
+	}
+	for _, packageToUpgrade := range sortedKeys(toUpgrade) {
+		log.Infof("Upgrading %s %s...\n", name, packageToUpgrade)
+		outcome := NewPackageOutcome(name, packageToUpgrade, upgradePackage(PackageManager, packageToUpgrade, toUpgrade[packageToUpgrade]))
+		if outcome.State == PackageInstalled {
+			outcome.State = PackageUpgraded
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	sortOutcomes(outcomes)
+	return outcomes
+}
+
+// installPackages installs packages in a single command, or one by one if
+// it fails.
+func installPackages(PackageManager pm.PackageManager, packages []string) (outcomes []PackageOutcome) {
+	errs := installBatch(PackageManager, packages)
+	for _, packageToInstall := range packages {
+		outcomes = append(outcomes, NewPackageOutcome(PackageManager.GetName(), packageToInstall, errs[packageToInstall]))
 	}
-	log.Infof("Installing %s packages...", PackageManager.GetName())
+	return outcomes
+}
 
+// installBatch installs packages in a single command, or one by one if it
+// fails, and returns the error of every package that failed.
+func installBatch(PackageManager pm.PackageManager, packages []string) map[string]error {
+	errs := make(map[string]error)
+	err := PackageManager.InstallMany(packages)
+	if err == nil {
+		return errs
+	}
+	log.Warningf("%s\nInstalling %s packages one by one...\n", err, PackageManager.GetName())
 	for _, packageToInstall := range packages {
 		if err := PackageManager.Install(packageToInstall); err != nil {
 			log.Errorln(err)
+			errs[packageToInstall] = err
 		}
 	}
+	return errs
+}
+
+// upgradePackage upgrades a package of env.yml installed under the given
+// name. Packages with a version constraint are installed again, so that
+// their constraint applies.
+func upgradePackage(PackageManager pm.PackageManager, entry string, installed string) error {
+	if spec, err := pm.ParsePackageSpec(entry); err == nil && len(spec.Constraints) > 0 && !strings.EqualFold(installed, entry) {
+		return PackageManager.Install(entry)
+	}
+	return PackageManager.UpgradeOne(installed)
+}
+
+// installedVersion returns the name under which a package of env.yml is
+// installed, if its installed version satisfies its version constraint.
+// Versioned names (brew node@20) satisfy their own version.
+func installedVersion(packageManager string, entry string, versions map[string]string) (string, bool) {
+	installed := make(map[string]bool)
+	for name := range versions {
+		installed[name] = true
+	}
+	name, ok := installedName(packageManager, entry, installed)
+	if !ok || strings.EqualFold(name, entry) {
+		return name, ok
+	}
+	spec, err := pm.ParsePackageSpec(entry)
+	if err != nil {
+		return "", false
+	}
+	return name, spec.Satisfies(versions[name])
 }
@@ -0,0 +1,145 @@
+package env
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanRestore(t *testing.T) {
+	registerFakePackageManager(t, "brew")
+	registerFakePackageManager(t, "cask").dependsOn = []string{"brew"}
+	registerFakePackageManager(t, "npm").dependsOn = []string{"brew"}
+	registerFakePackageManager(t, "apm").dependsOn = []string{"cask"}
+	registerFakePackageManager(t, "pip")
+
+	cases := []struct {
+		PackageManagers []string
+		Expected        [][]string
+	}{
+		{[]string{"apm", "npm", "pip", "cask", "brew"}, [][]string{{"brew", "pip"}, {"cask", "npm"}, {"apm"}}},
+		// Dependencies that aren't restored are ignored.
+		{[]string{"npm", "pip"}, [][]string{{"npm", "pip"}}},
+		{nil, nil},
+	}
+	for _, tc := range cases {
+		stages, err := PlanRestore(tc.PackageManagers)
+		if err != nil {
+			t.Errorf("PlanRestore(%v) failed: %s", tc.PackageManagers, err)
+			continue
+		}
+		if !reflect.DeepEqual(stages, tc.Expected) {
+			t.Errorf("PlanRestore(%v) returned wrong stages: got %#v want %#v", tc.PackageManagers, stages, tc.Expected)
+		}
+	}
+
+	registerFakePackageManager(t, "brew").dependsOn = []string{"cask"}
+	if _, err := PlanRestore([]string{"brew", "cask", "pip"}); !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("PlanRestore func returned wrong error: got %v want %v", err, ErrDependencyCycle)
+	}
+}
+
+func TestRestorePackages(t *testing.T) {
+	// The invalid packages of a package manager fail while the other ones of
+	// the stage are being installed.
+	setEnvPackages(t, map[string][]interface{}{"brew": {"git"}, "pip": {"requests@1 2"}, "npm": {"eslint"}})
+	brew := registerFakePackageManager(t, "brew")
+	npm := registerFakePackageManager(t, "npm")
+	registerFakePackageManager(t, "pip")
+
+	outcomes, err := RestorePackages([]string{"brew", "npm", "pip"}, InstallMissing)
+	if err != nil {
+		t.Fatalf("RestorePackages func failed: %s", err)
+	}
+	var states []string
+	for _, outcome := range outcomes {
+		states = append(states, outcome.PackageManager+" "+outcome.Package+" "+string(outcome.State))
+	}
+	expected := []string{"brew git installed", "npm eslint installed", "pip  failed"}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("RestorePackages func returned wrong outcomes: got %#v want %#v", states, expected)
+	}
+	if !reflect.DeepEqual(brew.installed, []string{"git"}) || !reflect.DeepEqual(npm.installed, []string{"eslint"}) {
+		t.Errorf("RestorePackages func installed wrong packages: got %#v and %#v", brew.installed, npm.installed)
+	}
+}
+
+func TestInstallPackages(t *testing.T) {
+	brew := registerFakePackageManager(t, "brew")
+	brew.versions["git"] = "2.42.0"
+	brew.versions["node@18"] = "18.17.1"
+	outcomes := InstallPackages(brew, []string{"git", "jq", "node@18"}, InstallMissing)
+	expected := []PackageOutcome{
+		{PackageManager: "brew", Package: "git", State: PackagePresent},
+		{PackageManager: "brew", Package: "jq", State: PackageInstalled},
+		{PackageManager: "brew", Package: "node@18", State: PackagePresent},
+	}
+	if brew.batches != 1 || !reflect.DeepEqual(brew.installed, []string{"jq"}) || !reflect.DeepEqual(outcomes, expected) {
+		t.Errorf("InstallPackages func returned wrong outcomes: got %#v installing %#v want %#v installing jq", outcomes, brew.installed, expected)
+	}
+
+	// Present packages are installed again with InstallReinstall, upgraded
+	// with InstallUpgrade.
+	outcomes = InstallPackages(brew, []string{"git", "jq"}, InstallReinstall)
+	if expected := []string{"jq", "git", "jq"}; !reflect.DeepEqual(brew.installed, expected) || outcomes[0].State != PackageInstalled {
+		t.Errorf("InstallPackages func reinstalled wrong packages: got %#v want %#v", brew.installed, expected)
+	}
+	outcomes = InstallPackages(brew, []string{"git", "wget"}, InstallUpgrade)
+	if !reflect.DeepEqual(brew.upgraded, []string{"git"}) || outcomes[0].State != PackageUpgraded || outcomes[1].State != PackageInstalled {
+		t.Errorf("InstallPackages func upgraded wrong packages: got %#v upgrading %#v want git upgraded", outcomes, brew.upgraded)
+	}
+
+	// A present package whose version doesn't satisfy its constraint is
+	// installed again.
+	pip := registerFakePackageManager(t, "pip")
+	pip.versions["requests"] = "1.2.0"
+	pip.versions["black"] = "23.10.1"
+	InstallPackages(pip, []string{"requests>=2,<3", "black==23.10"}, InstallMissing)
+	if expected := []string{"requests>=2,<3"}; !reflect.DeepEqual(pip.installed, expected) {
+		t.Errorf("InstallPackages func installed wrong packages: got %#v want %#v", pip.installed, expected)
+	}
+
+	// A failing batch falls back to one install per package.
+	pip = registerFakePackageManager(t, "pip")
+	pip.failing["broken"] = true
+	outcomes = InstallPackages(pip, []string{"black", "broken", "requests"}, InstallMissing)
+	if expected := []string{"black", "requests"}; pip.batches != 0 || !reflect.DeepEqual(pip.installed, expected) {
+		t.Errorf("InstallPackages func installed wrong packages: got %#v in %d batches want %#v one by one", pip.installed, pip.batches, expected)
+	}
+	if outcome := outcomes[1]; outcome.State != PackageFailed || outcome.Stderr != "No package broken" {
+		t.Errorf("InstallPackages func returned wrong outcome: %#v", outcome)
+	}
+}
+
+func TestPrintRestoreReport(t *testing.T) {
+	report := RestoreReport{Packages: []PackageOutcome{
+		{PackageManager: "brew", Package: "git", State: PackagePresent},
+		{PackageManager: "brew", Package: "jq", State: PackageInstalled},
+		{PackageManager: "brew", Package: "wget", State: PackageUpgraded},
+		{PackageManager: "pip", Package: "broken", State: PackageFailed, Error: "install failed", Stderr: "Collecting broken\nNo matching distribution"},
+		{PackageManager: "snap", State: PackageSkipped, Error: "unsupported package manager"},
+	}}
+	if !report.HasFailures() {
+		t.Errorf("HasFailures func returned false with a failed package")
+	}
+
+	var out bytes.Buffer
+	PrintRestoreReport(&out, report)
+	for _, expected := range []string{"failed: install failed (No matching distribution)", "snap     -", "1 installed, 1 upgraded, 1 already present, 1 failed, 1 skipped"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("PrintRestoreReport func output doesn't contain %q:\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := PrintRestoreReportJSON(&out, report); err != nil {
+		t.Fatalf("PrintRestoreReportJSON func failed: %s", err)
+	}
+	var decoded RestoreReport
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || !reflect.DeepEqual(decoded, report) {
+		t.Errorf("PrintRestoreReportJSON func returned wrong JSON: %s", out.String())
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDotfilesExcludes are never saved unless listed by name in
+// dotfiles.include. They hold caches, histories, and credentials.
+var DefaultDotfilesExcludes = []string{
+	// Caches and generated files
+	".cache", ".npm", ".yarn", ".node-gyp", ".cargo", ".rustup", ".gradle", ".m2",
+	".gem", ".bundle", ".pyenv", ".rbenv", ".nvm", ".local", ".Trash", ".DS_Store",
+	".CFUserTextEncoding", ".lesshst", ".viminfo", ".*_history", ".zcompdump*",
+	".zsh_sessions", ".dotfiles",
+	// Secrets
+	".ssh", ".gnupg", ".aws", ".azure", ".docker", ".kube", ".netrc", ".pgpass",
+	".git-credentials", ".npmrc", ".pypirc", ".config/gh", ".config/gcloud",
+	// The ian configuration, holding the journal of the import in progress
+	".config/ian",
+}
+
+// DotfilesRules selects the dotfiles to save from glob patterns matched
+// against paths relative to the home directory.
+type DotfilesRules struct {
+	// Includes restricts the saved dotfiles to the matching ones, if set.
+	// Dotfiles listed by name override DefaultDotfilesExcludes.
+	Includes []string
+	// Excludes are never saved.
+	Excludes []string
+}
+
+// Match returns whether the dotfile at the given path, relative to the home
+// directory, should be saved.
+func (r DotfilesRules) Match(path string) bool {
+	if matchAny(r.Excludes, path) {
+		return false
+	}
+	if len(r.Includes) > 0 && !matchAny(r.Includes, path) {
+		return false
+	}
+	return isListed(r.Includes, path) || !matchAny(DefaultDotfilesExcludes, path)
+}
+
+// HasIncludesUnder returns whether some includes match paths inside the
+// directory at path.
+func (r DotfilesRules) HasIncludesUnder(path string) bool {
+	dirs := strings.Split(filepath.Clean(path), string(filepath.Separator))
+	for _, pattern := range r.Includes {
+		parts := strings.Split(filepath.Clean(pattern), string(filepath.Separator))
+		if len(parts) <= len(dirs) {
+			continue
+		}
+		under := true
+		for i, dir := range dirs {
+			if ok, _ := filepath.Match(parts[i], dir); !ok {
+				under = false
+				break
+			}
+		}
+		if under {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny returns whether path, or one of its parent directories, matches
+// one of the glob patterns.
+func matchAny(patterns []string, path string) bool {
+	path = filepath.Clean(path)
+	for {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(strings.TrimSuffix(pattern, "/"), path); ok {
+				return true
+			}
+		}
+		parent := filepath.Dir(path)
+		if parent == "." || parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// isListed returns whether path, or one of its parent directories, is one of
+// the patterns taken literally.
+func isListed(patterns []string, path string) bool {
+	path = filepath.Clean(path)
+	for _, pattern := range patterns {
+		pattern = filepath.Clean(pattern)
+		if pattern == path || strings.HasPrefix(path, pattern+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
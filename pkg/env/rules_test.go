@@ -0,0 +1,77 @@
+package env
+
+import "testing"
+
+func TestDotfilesRulesMatch(t *testing.T) {
+	cases := []struct {
+		Rules    DotfilesRules
+		Path     string
+		Expected bool
+	}{
+		{DotfilesRules{}, ".vimrc", true},
+		{DotfilesRules{}, ".cache", false},
+		{DotfilesRules{}, ".zsh_history", false},
+		{DotfilesRules{}, ".ssh", false},
+		{DotfilesRules{}, ".ssh/config", false},
+		{DotfilesRules{}, ".config/nvim", true},
+		{DotfilesRules{}, ".config/gh/hosts.yml", false},
+		{DotfilesRules{Includes: []string{".config/nvim"}}, ".config/nvim/init.lua", true},
+		{DotfilesRules{Includes: []string{".config/nvim"}}, ".config", false},
+		{DotfilesRules{Includes: []string{".local/bin"}}, ".local/bin/ian", true},
+		{DotfilesRules{Excludes: []string{".vim*"}}, ".vimrc", false},
+		{DotfilesRules{Includes: []string{".vimrc", ".zshrc"}}, ".vimrc", true},
+		{DotfilesRules{Includes: []string{".vimrc", ".zshrc"}}, ".bashrc", false},
+		{DotfilesRules{Includes: []string{".*"}}, ".npmrc", false},
+		{DotfilesRules{Includes: []string{".npmrc"}}, ".npmrc", true},
+		{DotfilesRules{Includes: []string{".npmrc"}, Excludes: []string{".npmrc"}}, ".npmrc", false},
+	}
+	for _, tc := range cases {
+		if got := tc.Rules.Match(tc.Path); got != tc.Expected {
+			t.Errorf("Match func returned wrong value for %s with %#v: got %t want %t",
+				tc.Path, tc.Rules, got, tc.Expected)
+		}
+	}
+}
+
+func TestDotfilesRulesHasIncludesUnder(t *testing.T) {
+	rules := DotfilesRules{Includes: []string{".vimrc", ".config/nvim", ".local/*/ian"}}
+	cases := []struct {
+		Path     string
+		Expected bool
+	}{
+		{".config", true},
+		{".config/nvim", false},
+		{".local", true},
+		{".local/share", true},
+		{".vim", false},
+	}
+	for _, tc := range cases {
+		if got := rules.HasIncludesUnder(tc.Path); got != tc.Expected {
+			t.Errorf("HasIncludesUnder func returned wrong value for %s: got %t want %t",
+				tc.Path, got, tc.Expected)
+		}
+	}
+}
+
+func TestGetDotfileRelativePath(t *testing.T) {
+	cases := []struct {
+		Path        string
+		Expected    string
+		ExpectedErr error
+	}{
+		{".vimrc", ".vimrc", nil},
+		{"~/.vimrc", ".vimrc", nil},
+		{"/home/test/.vimrc", ".vimrc", nil},
+		{".config/nvim/", ".config/nvim", nil},
+		{"/etc/hosts", "", ErrInvalidDotfilePath},
+		{"../.vimrc", "", ErrInvalidDotfilePath},
+		{"~", "", ErrInvalidDotfilePath},
+	}
+	for _, tc := range cases {
+		got, err := GetDotfileRelativePath(tc.Path, "/home/test")
+		if got != tc.Expected || err != tc.ExpectedErr {
+			t.Errorf("GetDotfileRelativePath func returned wrong value for %s: got (%s, %#v) want (%s, %#v)",
+				tc.Path, got, err, tc.Expected, tc.ExpectedErr)
+		}
+	}
+}
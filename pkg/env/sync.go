@@ -0,0 +1,137 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	pm "github.com/thylong/ian/pkg/package-managers"
+)
+
+// SyncAction is what a sync step does to a package.
+type SyncAction string
+
+const (
+	// SyncInstall installs a package declared in env.yml.
+	SyncInstall SyncAction = "install"
+	// SyncUninstall uninstalls a package not declared in env.yml.
+	SyncUninstall SyncAction = "uninstall"
+)
+
+// SyncStep is an action on a package to converge to env.yml.
+type SyncStep struct {
+	PackageManager string
+	Package        string
+	Action         SyncAction
+}
+
+// SyncOutcome is the outcome of a SyncStep.
+type SyncOutcome struct {
+	SyncStep
+	Err error
+}
+
+// SyncOptions sets how PlanSync converges to env.yml.
+type SyncOptions struct {
+	// Prune uninstalls the packages installed on purpose but not declared.
+	Prune bool
+	// PruneOS prunes the packages of apt and yum too. They're left out by
+	// default, as these package managers also list the base system packages
+	// as installed on purpose (see ListsSystemPackages).
+	PruneOS bool
+}
+
+// PlanSync returns the steps to converge to env.yml: the missing packages
+// are installed and, depending on opts, the undeclared ones are uninstalled.
+func PlanSync(diffs []PackagesDiff, opts SyncOptions) (steps []SyncStep) {
+	for _, diff := range diffs {
+		if diff.Error != "" {
+			continue
+		}
+		for _, name := range diff.Missing {
+			steps = append(steps, SyncStep{PackageManager: diff.PackageManager, Package: name, Action: SyncInstall})
+		}
+		if !opts.Prune || (!opts.PruneOS && pm.GetPackageManager(diff.PackageManager).ListsSystemPackages()) {
+			continue
+		}
+		for _, name := range diff.Undeclared {
+			steps = append(steps, SyncStep{PackageManager: diff.PackageManager, Package: name, Action: SyncUninstall})
+		}
+	}
+	return steps
+}
+
+// ApplySync runs the steps through their package manager. A failing step
+// doesn't stop the next ones.
+func ApplySync(steps []SyncStep) (outcomes []SyncOutcome) {
+	for _, step := range steps {
+		packageManager := pm.GetPackageManager(step.PackageManager)
+		var err error
+		switch step.Action {
+		case SyncInstall:
+			err = packageManager.Install(step.Package)
+		case SyncUninstall:
+			err = packageManager.Uninstall(step.Package)
+		}
+		outcomes = append(outcomes, SyncOutcome{SyncStep: step, Err: err})
+	}
+	return outcomes
+}
+
+// HasSyncFailures returns true if a step failed.
+func HasSyncFailures(outcomes []SyncOutcome) bool {
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintSyncPlan writes the steps and the package managers left out.
+func PrintSyncPlan(w io.Writer, diffs []PackagesDiff, steps []SyncStep) {
+	for _, diff := range diffs {
+		if diff.Error != "" {
+			fmt.Fprintf(w, "Skipping %s: %s\n", diff.PackageManager, diff.Error)
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, step := range steps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", step.Action, step.PackageManager, step.Package)
+	}
+	tw.Flush()
+}
+
+// PrintSyncOutcomes writes the outcome of every step followed by a summary.
+func PrintSyncOutcomes(w io.Writer, outcomes []SyncOutcome) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tMANAGER\tPACKAGE\tRESULT")
+	counts := make(map[SyncAction]int)
+	failed := 0
+	for _, outcome := range outcomes {
+		result := "ok"
+		if outcome.Err != nil {
+			result = fmt.Sprintf("failed: %s", outcome.Err)
+			failed++
+		} else {
+			counts[outcome.Action]++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", outcome.Action, outcome.PackageManager, outcome.Package, result)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d installed, %d uninstalled, %d failed\n", counts[SyncInstall], counts[SyncUninstall], failed)
+}
@@ -0,0 +1,160 @@
+package env
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thylong/ian/pkg/command"
+	pm "github.com/thylong/ian/pkg/package-managers"
+)
+
+// fakePackageManager records the packages installed, upgraded and
+// uninstalled, and the versions installed, "latest" when not pinned.
+type fakePackageManager struct {
+	name             string
+	installed        []string
+	uninstalled      []string
+	upgraded         []string
+	osPackageManager bool
+	systemPackages   bool
+	// userInstalled are the packages installed on purpose, installed if nil.
+	userInstalled []string
+	failing       map[string]bool
+	versions      map[string]string
+	batches       int
+	dependsOn     []string
+}
+
+func (f *fakePackageManager) Install(name string) error {
+	if f.failing[name] {
+		return fmt.Errorf("install failed: %w", &command.ExecError{Err: errors.New("exit status 1"), Stderr: "No package " + name})
+	}
+	f.installed = append(f.installed, name)
+	if spec, err := pm.ParsePackageSpec(name); err == nil {
+		f.versions[spec.Name] = "latest"
+		if version, ok := spec.ExactVersion(); ok {
+			f.versions[spec.Name] = version
+		}
+	}
+	return nil
+}
+func (f *fakePackageManager) InstallMany(names []string) error {
+	for _, name := range names {
+		if f.failing[name] {
+			return errors.New("install failed")
+		}
+	}
+	for _, name := range names {
+		f.Install(name)
+	}
+	f.batches++
+	return nil
+}
+func (f *fakePackageManager) Uninstall(name string) error {
+	if f.failing[name] {
+		return errors.New("uninstall failed")
+	}
+	f.uninstalled = append(f.uninstalled, name)
+	return nil
+}
+func (f *fakePackageManager) Cleanup() error         { return nil }
+func (f *fakePackageManager) UpdateOne(string) error { return nil }
+func (f *fakePackageManager) UpgradeOne(name string) error {
+	f.upgraded = append(f.upgraded, name)
+	return nil
+}
+func (f *fakePackageManager) UpdateAll() error                 { return nil }
+func (f *fakePackageManager) UpgradeAll() error                { return nil }
+func (f *fakePackageManager) IsInstalled() bool                { return true }
+func (f *fakePackageManager) IsOSPackageManager() bool         { return f.osPackageManager }
+func (f *fakePackageManager) ListsSystemPackages() bool        { return f.systemPackages }
+func (f *fakePackageManager) GetExecPath() string              { return "/bin/" + f.name }
+func (f *fakePackageManager) GetName() string                  { return f.name }
+func (f *fakePackageManager) Setup() error                     { return nil }
+func (f *fakePackageManager) ListInstalled() ([]string, error) { return f.installed, nil }
+func (f *fakePackageManager) ListUserInstalled() ([]string, error) {
+	if f.userInstalled != nil {
+		return f.userInstalled, nil
+	}
+	return f.installed, nil
+}
+func (f *fakePackageManager) PackageArgs(spec pm.PackageSpec) ([]string, error) {
+	return []string{spec.String()}, nil
+}
+func (f *fakePackageManager) DependsOn() []string { return f.dependsOn }
+func (f *fakePackageManager) InstalledVersions() (map[string]string, error) {
+	versions := make(map[string]string)
+	for name, version := range f.versions {
+		versions[name] = version
+	}
+	return versions, nil
+}
+
+// registerFakePackageManager replaces a supported package manager by a fake
+// one until the end of the test.
+func registerFakePackageManager(t *testing.T, name string) *fakePackageManager {
+	previous := pm.SupportedPackageManagers[name]
+	t.Cleanup(func() { pm.SupportedPackageManagers[name] = previous })
+	fake := &fakePackageManager{name: name, failing: make(map[string]bool), versions: make(map[string]string)}
+	pm.SupportedPackageManagers[name] = fake
+	return fake
+}
+
+func TestPlanSync(t *testing.T) {
+	// Brew is the OS package manager on macOS, but only lists leaves.
+	registerFakePackageManager(t, "brew").osPackageManager = true
+	registerFakePackageManager(t, "pip")
+	registerFakePackageManager(t, "apt").systemPackages = true
+	diffs := []PackagesDiff{
+		{PackageManager: "apt", Missing: []string{"curl"}, Undeclared: []string{"openssh-server", "sudo"}},
+		{PackageManager: "brew", Missing: []string{"htop"}, Undeclared: []string{"jq"}},
+		{PackageManager: "pip", Missing: []string{"black"}, Error: "pip is not installed"},
+	}
+	cases := []struct {
+		Opts     SyncOptions
+		Expected []SyncStep
+	}{
+		{SyncOptions{}, []SyncStep{{"apt", "curl", SyncInstall}, {"brew", "htop", SyncInstall}}},
+		// The base system packages of apt are kept, brew leaves are pruned.
+		{SyncOptions{Prune: true}, []SyncStep{{"apt", "curl", SyncInstall}, {"brew", "htop", SyncInstall}, {"brew", "jq", SyncUninstall}}},
+		{SyncOptions{Prune: true, PruneOS: true}, []SyncStep{
+			{"apt", "curl", SyncInstall}, {"apt", "openssh-server", SyncUninstall}, {"apt", "sudo", SyncUninstall},
+			{"brew", "htop", SyncInstall}, {"brew", "jq", SyncUninstall},
+		}},
+	}
+	for _, tc := range cases {
+		if steps := PlanSync(diffs, tc.Opts); !reflect.DeepEqual(steps, tc.Expected) {
+			t.Errorf("PlanSync func with %+v returned wrong steps: got %#v want %#v", tc.Opts, steps, tc.Expected)
+		}
+	}
+}
+
+func TestApplySync(t *testing.T) {
+	brew := registerFakePackageManager(t, "brew")
+	brew.failing["broken"] = true
+
+	outcomes := ApplySync([]SyncStep{
+		{"brew", "htop", SyncInstall},
+		{"brew", "broken", SyncInstall},
+		{"brew", "jq", SyncUninstall},
+	})
+	if !reflect.DeepEqual(brew.installed, []string{"htop"}) || !reflect.DeepEqual(brew.uninstalled, []string{"jq"}) {
+		t.Errorf("ApplySync func didn't apply the steps: installed %#v, uninstalled %#v", brew.installed, brew.uninstalled)
+	}
+	if len(outcomes) != 3 || outcomes[0].Err != nil || outcomes[1].Err == nil || outcomes[2].Err != nil {
+		t.Errorf("ApplySync func returned wrong outcomes: %#v", outcomes)
+	}
+	if !HasSyncFailures(outcomes) {
+		t.Errorf("HasSyncFailures func returned false with a failing step")
+	}
+
+	var buf bytes.Buffer
+	PrintSyncOutcomes(&buf, outcomes)
+	if !strings.Contains(buf.String(), "1 installed, 1 uninstalled, 1 failed") {
+		t.Errorf("PrintSyncOutcomes func returned wrong summary:\n%s", buf.String())
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/thylong/ian/pkg/command"
 )
@@ -34,12 +36,37 @@ type ApmPackageManager struct {
 
 // Install given Apm package.
 func (apm *ApmPackageManager) Install(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(apm.Path, "install", packageName)); err != nil {
-		return fmt.Errorf("Cannot %s install %s: %s", apm.Name, packageName, err)
+	args, err := installArgs(apm, packageName)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(apm.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", apm.Name, packageName, err)
+	}
+	return err
+}
+
+// InstallMany installs the given Apm packages in a single command.
+func (apm *ApmPackageManager) InstallMany(packageNames []string) (err error) {
+	if len(packageNames) == 0 {
+		return nil
+	}
+	args, err := installManyArgs(apm, packageNames)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(apm.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", apm.Name, strings.Join(packageNames, " "), err)
 	}
 	return err
 }
 
+// PackageArgs returns the install arguments of an Apm package (name@version).
+// Only exact versions are supported.
+func (apm *ApmPackageManager) PackageArgs(spec PackageSpec) ([]string, error) {
+	return exactVersionArgs(apm.Name, spec, "@")
+}
+
 // Uninstall given Apm package.
 func (apm *ApmPackageManager) Uninstall(packageName string) (err error) {
 	if err = command.ExecuteCommand(execCommand(apm.Path, "uninstall", packageName)); err != nil {
@@ -105,6 +132,12 @@ func (apm *ApmPackageManager) IsOSPackageManager() bool {
 	return false
 }
 
+// ListsSystemPackages returns false, as Apm only lists the packages
+// installed on purpose.
+func (apm *ApmPackageManager) ListsSystemPackages() bool {
+	return false
+}
+
 // GetExecPath return immutable path to Apm executable.
 func (apm *ApmPackageManager) GetExecPath() string {
 	return apm.Path
@@ -119,3 +152,39 @@ func (apm *ApmPackageManager) GetName() string {
 func (apm *ApmPackageManager) Setup() (err error) {
 	return nil
 }
+
+// ListInstalled returns the installed Atom packages.
+func (apm *ApmPackageManager) ListInstalled() (packages []string, err error) {
+	out, err := command.ExecuteCommandOutput(execCommand(apm.Path, "list", "--installed", "--bare"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", apm.Name, err)
+	}
+	for _, line := range parseLines(out) {
+		packages = append(packages, strings.SplitN(line, "@", 2)[0])
+	}
+	return packages, nil
+}
+
+// ListUserInstalled returns the installed Atom packages, as --installed
+// already leaves out the bundled ones.
+func (apm *ApmPackageManager) ListUserInstalled() ([]string, error) {
+	return apm.ListInstalled()
+}
+
+// InstalledVersions returns the version of every installed Atom package.
+func (apm *ApmPackageManager) InstalledVersions() (map[string]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(apm.Path, "list", "--installed", "--bare"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", apm.Name, err)
+	}
+	return parseVersions(out, "@"), nil
+}
+
+// DependsOn returns the package manager installing Atom, which provides apm:
+// cask on Mac OS, otherwise the OS package manager.
+func (apm *ApmPackageManager) DependsOn() []string {
+	if runtime.GOOS == "darwin" {
+		return []string{"cask"}
+	}
+	return osPackageManagerNames()
+}
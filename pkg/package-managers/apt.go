@@ -39,12 +39,37 @@ type AptPackageManager struct {
 
 // Install given Apt package.
 func (apt *AptPackageManager) Install(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(apt.Path, "install", packageName)); err != nil {
-		return fmt.Errorf("Cannot %s install: %s", apt.Name, err)
+	args, err := installArgs(apt, packageName)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(apt.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install: %w", apt.Name, err)
+	}
+	return err
+}
+
+// InstallMany installs the given Apt packages in a single command.
+func (apt *AptPackageManager) InstallMany(packageNames []string) (err error) {
+	if len(packageNames) == 0 {
+		return nil
+	}
+	args, err := installManyArgs(apt, packageNames)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(apt.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install: %w", apt.Name, err)
 	}
 	return err
 }
 
+// PackageArgs returns the install arguments of an Apt package (name=version).
+// Only exact versions are supported.
+func (apt *AptPackageManager) PackageArgs(spec PackageSpec) ([]string, error) {
+	return exactVersionArgs(apt.Name, spec, "=")
+}
+
 // Uninstall given Apt package.
 func (apt *AptPackageManager) Uninstall(packageName string) (err error) {
 	if err = command.ExecuteCommand(execCommand(apt.Path, "remove", packageName)); err != nil {
@@ -70,7 +95,7 @@ func (apt *AptPackageManager) UpdateOne(packageName string) (err error) {
 
 // UpgradeOne Npm packages to the last known versions.
 func (apt *AptPackageManager) UpgradeOne(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(apt.Path, "upgrade", packageName)); err != nil {
+	if err = command.ExecuteCommand(execCommand(apt.Path, "install", "--only-upgrade", packageName)); err != nil {
 		return fmt.Errorf("Cannot %s upgrade: %s", apt.Name, err)
 	}
 	return err
@@ -101,6 +126,12 @@ func (apt *AptPackageManager) IsOSPackageManager() bool {
 	return apt.IsInstalled() && runtime.GOOS == "linux"
 }
 
+// ListsSystemPackages returns true, as the base system packages are marked as
+// installed on purpose by Apt.
+func (apt *AptPackageManager) ListsSystemPackages() bool {
+	return true
+}
+
 // GetExecPath return immutable path to Apt executable.
 func (apt *AptPackageManager) GetExecPath() string {
 	return apt.Path
@@ -115,3 +146,35 @@ func (apt *AptPackageManager) GetName() string {
 func (apt *AptPackageManager) Setup() (err error) {
 	return nil
 }
+
+// ListInstalled returns the installed Apt packages.
+func (apt *AptPackageManager) ListInstalled() ([]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand("dpkg-query", "-W", "-f=${Package}\n"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", apt.Name, err)
+	}
+	return parseLines(out), nil
+}
+
+// ListUserInstalled returns the Apt packages marked as manually installed.
+func (apt *AptPackageManager) ListUserInstalled() ([]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand("apt-mark", "showmanual"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", apt.Name, err)
+	}
+	return parseLines(out), nil
+}
+
+// InstalledVersions returns the version of every installed Apt package.
+func (apt *AptPackageManager) InstalledVersions() (map[string]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand("dpkg-query", "-W", "-f=${Package} ${Version}\n"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", apt.Name, err)
+	}
+	return parseVersions(out, " "), nil
+}
+
+// DependsOn returns nothing, as Apt is an OS package manager.
+func (apt *AptPackageManager) DependsOn() []string {
+	return nil
+}
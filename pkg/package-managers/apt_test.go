@@ -2,6 +2,7 @@ package packagemanagers
 
 import (
 	"os/exec"
+	"reflect"
 	"testing"
 )
 
@@ -60,3 +61,17 @@ func TestAptGetExecPath(t *testing.T) {
 			PackageManager.GetExecPath(), PackageManager.Path)
 	}
 }
+
+func TestAptInstallLockedVersion(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.Command; mockExecCalls = nil }()
+
+	mockExecCalls = nil
+	if err := Apt.Install("git@1:2.39.2-1.1"); err != nil {
+		t.Fatalf("apt Install returned an error: %s", err)
+	}
+	expected := [][]string{{Apt.Path, "install", "git=1:2.39.2-1.1"}}
+	if !reflect.DeepEqual(mockExecCalls, expected) {
+		t.Errorf("apt Install ran wrong commands: got %#v want %#v", mockExecCalls, expected)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/thylong/ian/pkg/command"
 )
@@ -37,12 +38,37 @@ type BrewPackageManager struct {
 
 // Install given Brew package.
 func (brew *BrewPackageManager) Install(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(brew.Path, "install", packageName)); err != nil {
-		return fmt.Errorf("Cannot %s install %s: %s", brew.Name, packageName, err)
+	args, err := installArgs(brew, packageName)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(brew.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", brew.Name, packageName, err)
 	}
 	return err
 }
 
+// InstallMany installs the given Brew packages in a single command.
+func (brew *BrewPackageManager) InstallMany(packageNames []string) (err error) {
+	if len(packageNames) == 0 {
+		return nil
+	}
+	args, err := installManyArgs(brew, packageNames)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(brew.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", brew.Name, strings.Join(packageNames, " "), err)
+	}
+	return err
+}
+
+// PackageArgs returns the install arguments of a Brew package. A version is
+// a versioned formula (node@20), so only exact versions are supported.
+func (brew *BrewPackageManager) PackageArgs(spec PackageSpec) ([]string, error) {
+	return exactVersionArgs(brew.Name, spec, "@")
+}
+
 // Uninstall given Brew package.
 func (brew *BrewPackageManager) Uninstall(packageName string) (err error) {
 	if err = command.ExecuteCommand(execCommand(brew.Path, "uninstall", packageName)); err != nil {
@@ -70,7 +96,7 @@ func (brew *BrewPackageManager) UpdateOne(packageName string) (err error) {
 
 // UpgradeOne Brew packages to the last known versions.
 func (brew *BrewPackageManager) UpgradeOne(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(brew.Path, "upgrade")); err != nil {
+	if err = command.ExecuteCommand(execCommand(brew.Path, "upgrade", packageName)); err != nil {
 		return fmt.Errorf("Cannot %s upgrade %s: %s", brew.Name, packageName, err)
 	}
 	return err
@@ -107,6 +133,12 @@ func (brew *BrewPackageManager) IsOSPackageManager() bool {
 	return runtime.GOOS == "darwin"
 }
 
+// ListsSystemPackages returns false, as Brew only lists the packages
+// installed on purpose.
+func (brew *BrewPackageManager) ListsSystemPackages() bool {
+	return false
+}
+
 // GetExecPath return immutable path to Brew executable.
 func (brew *BrewPackageManager) GetExecPath() string {
 	return brew.Path
@@ -134,3 +166,36 @@ func (brew *BrewPackageManager) Setup() (err error) {
 	)
 	return nil
 }
+
+// ListInstalled returns the installed Brew formulae.
+func (brew *BrewPackageManager) ListInstalled() ([]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(brew.Path, "list", "--formula", "-1"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", brew.Name, err)
+	}
+	return parseLines(out), nil
+}
+
+// ListUserInstalled returns the Brew formulae installed on purpose, not as
+// a dependency.
+func (brew *BrewPackageManager) ListUserInstalled() ([]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(brew.Path, "leaves"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", brew.Name, err)
+	}
+	return parseLines(out), nil
+}
+
+// InstalledVersions returns the version of every installed Brew formula.
+func (brew *BrewPackageManager) InstalledVersions() (map[string]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(brew.Path, "list", "--formula", "--versions"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", brew.Name, err)
+	}
+	return parseBrewVersions(out), nil
+}
+
+// DependsOn returns nothing, as Brew is an OS package manager.
+func (brew *BrewPackageManager) DependsOn() []string {
+	return nil
+}
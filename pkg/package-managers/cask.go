@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/thylong/ian/pkg/command"
 )
@@ -36,12 +37,40 @@ type CaskPackageManager struct {
 
 // Install given Cask package.
 func (cask *CaskPackageManager) Install(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(cask.Path, "cask", "install", packageName)); err != nil {
-		return fmt.Errorf("Cannot %s install %s: %s", cask.Name, packageName, err)
+	args, err := installArgs(cask, packageName)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(cask.Path, append([]string{"cask", "install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", cask.Name, packageName, err)
+	}
+	return err
+}
+
+// InstallMany installs the given Cask packages in a single command.
+func (cask *CaskPackageManager) InstallMany(packageNames []string) (err error) {
+	if len(packageNames) == 0 {
+		return nil
+	}
+	args, err := installManyArgs(cask, packageNames)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(cask.Path, append([]string{"cask", "install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", cask.Name, strings.Join(packageNames, " "), err)
 	}
 	return err
 }
 
+// PackageArgs returns the install arguments of a Cask package. Casks can't
+// be pinned to a version.
+func (cask *CaskPackageManager) PackageArgs(spec PackageSpec) ([]string, error) {
+	if len(spec.Constraints) > 0 {
+		return nil, &UnsupportedConstraintError{PackageManager: cask.Name, Spec: spec, Reason: "casks can't be pinned to a version"}
+	}
+	return []string{spec.Name}, nil
+}
+
 // Uninstall given Cask package.
 func (cask *CaskPackageManager) Uninstall(packageName string) (err error) {
 	if err = command.ExecuteCommand(execCommand(cask.Path, "cask", "uninstall", packageName)); err != nil {
@@ -67,7 +96,7 @@ func (cask *CaskPackageManager) UpdateOne(packageName string) (err error) {
 
 // UpgradeOne Cask packages to the last known versions.
 func (cask *CaskPackageManager) UpgradeOne(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(cask.Path, "cask", "upgrade")); err != nil {
+	if err = command.ExecuteCommand(execCommand(cask.Path, "upgrade", "--cask", packageName)); err != nil {
 		return fmt.Errorf("Cannot %s upgrade %s: %s", cask.Name, packageName, err)
 	}
 	return err
@@ -104,6 +133,12 @@ func (cask *CaskPackageManager) IsOSPackageManager() bool {
 	return false
 }
 
+// ListsSystemPackages returns false, as Cask only lists the packages
+// installed on purpose.
+func (cask *CaskPackageManager) ListsSystemPackages() bool {
+	return false
+}
+
 // GetExecPath return immutable path to Cask executable.
 func (cask *CaskPackageManager) GetExecPath() string {
 	return cask.Path
@@ -123,3 +158,32 @@ func (cask *CaskPackageManager) Setup() (err error) {
 	fmt.Print("cask already installed, skipping...")
 	return nil
 }
+
+// ListInstalled returns the installed casks.
+func (cask *CaskPackageManager) ListInstalled() ([]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(cask.Path, "list", "--cask", "-1"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", cask.Name, err)
+	}
+	return parseLines(out), nil
+}
+
+// ListUserInstalled returns the installed casks, as they are always
+// installed on purpose.
+func (cask *CaskPackageManager) ListUserInstalled() ([]string, error) {
+	return cask.ListInstalled()
+}
+
+// InstalledVersions returns the version of every installed cask.
+func (cask *CaskPackageManager) InstalledVersions() (map[string]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(cask.Path, "list", "--cask", "--versions"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", cask.Name, err)
+	}
+	return parseBrewVersions(out), nil
+}
+
+// DependsOn returns brew, as casks are installed by Brew.
+func (cask *CaskPackageManager) DependsOn() []string {
+	return []string{"brew"}
+}
@@ -15,10 +15,13 @@
 package packagemanagers
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/thylong/ian/pkg/command"
 )
@@ -38,12 +41,55 @@ type NpmPackageManager struct {
 
 // Install given Npm package.
 func (npm *NpmPackageManager) Install(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(npm.Path, "install", "-g", packageName)); err != nil {
-		return fmt.Errorf("Cannot %s install %s: %s", npm.Name, packageName, err)
+	args, err := installArgs(npm, packageName)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(npm.Path, append([]string{"install", "-g"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", npm.Name, packageName, err)
+	}
+	return err
+}
+
+// InstallMany installs the given Npm packages in a single command.
+func (npm *NpmPackageManager) InstallMany(packageNames []string) (err error) {
+	if len(packageNames) == 0 {
+		return nil
+	}
+	args, err := installManyArgs(npm, packageNames)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(npm.Path, append([]string{"install", "-g"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", npm.Name, strings.Join(packageNames, " "), err)
 	}
 	return err
 }
 
+// PackageArgs returns the install arguments of a Npm package: name@version
+// or a range (name@>=18 <21).
+func (npm *NpmPackageManager) PackageArgs(spec PackageSpec) ([]string, error) {
+	if version, ok := spec.ExactVersion(); ok {
+		return []string{spec.Name + "@" + version}, nil
+	}
+	if len(spec.Constraints) == 0 {
+		return []string{spec.Name}, nil
+	}
+	var constraints []string
+	for _, constraint := range spec.Constraints {
+		switch constraint.Operator {
+		case "!=":
+			return nil, &UnsupportedConstraintError{PackageManager: npm.Name, Spec: spec, Reason: "!= isn't supported"}
+		case "~>", "~=":
+			// npm's ~ doesn't bump the same segment, the range is spelled out.
+			constraints = append(constraints, ">="+constraint.Version, "<"+compatibleUpperBound(constraint.Version))
+		default:
+			constraints = append(constraints, constraint.Operator+constraint.Version)
+		}
+	}
+	return []string{spec.Name + "@" + strings.Join(constraints, " ")}, nil
+}
+
 // Uninstall given Npm package.
 func (npm *NpmPackageManager) Uninstall(packageName string) (err error) {
 	if err = command.ExecuteCommand(execCommand(npm.Path, "uninstall", "-g", packageName)); err != nil {
@@ -69,7 +115,7 @@ func (npm *NpmPackageManager) UpdateOne(packageName string) (err error) {
 
 // UpgradeOne Npm packages to the last known versions.
 func (npm *NpmPackageManager) UpgradeOne(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(npm.Path, "upgrade", packageName)); err != nil {
+	if err = command.ExecuteCommand(execCommand(npm.Path, "update", "-g", packageName)); err != nil {
 		return fmt.Errorf("Cannot %s upgrade %s: %s", npm.Name, packageName, err)
 	}
 	return err
@@ -101,6 +147,12 @@ func (npm *NpmPackageManager) IsOSPackageManager() bool {
 	return false
 }
 
+// ListsSystemPackages returns false, as Npm only lists the packages
+// installed on purpose.
+func (npm *NpmPackageManager) ListsSystemPackages() bool {
+	return false
+}
+
 // GetExecPath return immutable path to Npm executable.
 func (npm *NpmPackageManager) GetExecPath() string {
 	return npm.Path
@@ -115,3 +167,54 @@ func (npm *NpmPackageManager) GetName() string {
 func (npm *NpmPackageManager) Setup() (err error) {
 	return nil
 }
+
+// ListInstalled returns the globally installed Npm packages.
+func (npm *NpmPackageManager) ListInstalled() (packages []string, err error) {
+	out, err := command.ExecuteCommandOutput(execCommand(npm.Path, "ls", "-g", "--depth=0", "--json"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", npm.Name, err)
+	}
+	var tree struct {
+		Dependencies map[string]interface{} `json:"dependencies"`
+	}
+	if err = json.Unmarshal([]byte(out), &tree); err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", npm.Name, err)
+	}
+	for name := range tree.Dependencies {
+		packages = append(packages, name)
+	}
+	sort.Strings(packages)
+	return packages, nil
+}
+
+// ListUserInstalled returns the globally installed Npm packages, as they are
+// always installed on purpose.
+func (npm *NpmPackageManager) ListUserInstalled() ([]string, error) {
+	return npm.ListInstalled()
+}
+
+// InstalledVersions returns the version of every globally installed Npm package.
+func (npm *NpmPackageManager) InstalledVersions() (map[string]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(npm.Path, "ls", "-g", "--depth=0", "--json"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", npm.Name, err)
+	}
+	var tree struct {
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if err = json.Unmarshal([]byte(out), &tree); err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", npm.Name, err)
+	}
+	versions := make(map[string]string)
+	for name, dependency := range tree.Dependencies {
+		versions[name] = dependency.Version
+	}
+	return versions, nil
+}
+
+// DependsOn returns the OS package manager, which installs node.
+func (npm *NpmPackageManager) DependsOn() []string {
+	return osPackageManagerNames()
+}
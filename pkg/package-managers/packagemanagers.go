@@ -17,11 +17,13 @@ package packagemanagers
 import (
 	"errors"
 	"os/exec"
+	"strings"
 )
 
 // PackageManager handles standard interactions with all Package Managers.
 type PackageManager interface {
 	Install(packageName string) error
+	InstallMany(packageNames []string) error
 	Uninstall(packageName string) error
 	Cleanup() error
 	UpdateOne(string) error
@@ -30,9 +32,17 @@ type PackageManager interface {
 	UpgradeAll() error
 	IsInstalled() bool
 	IsOSPackageManager() bool
+	// ListsSystemPackages returns true if ListUserInstalled includes the
+	// base system packages (apt, yum).
+	ListsSystemPackages() bool
 	GetExecPath() string
 	GetName() string
 	Setup() error
+	ListInstalled() ([]string, error)
+	ListUserInstalled() ([]string, error)
+	PackageArgs(spec PackageSpec) ([]string, error)
+	InstalledVersions() (map[string]string, error)
+	DependsOn() []string
 }
 
 // SupportedPackageManagers contains all the currently supported package managers.
@@ -100,3 +110,45 @@ func IsSupportedPackageManager(packageManager string) bool {
 	}
 	return true
 }
+
+// osPackageManagerNames returns the name of the OS package manager, if any.
+func osPackageManagerNames() []string {
+	if packageManager, err := GetOSPackageManager(); err == nil {
+		return []string{packageManager.GetName()}
+	}
+	return nil
+}
+
+// parseLines returns the non-empty lines of a command output.
+func parseLines(out string) (lines []string) {
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// parseVersions returns the versions per package of a command output made
+// of name, separator and version lines.
+func parseVersions(out string, separator string) map[string]string {
+	versions := make(map[string]string)
+	for _, line := range parseLines(out) {
+		if parts := strings.SplitN(line, separator, 2); len(parts) == 2 {
+			versions[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return versions
+}
+
+// parseBrewVersions returns the versions per package of brew list --versions,
+// the last version of a package being kept when several are installed.
+func parseBrewVersions(out string) map[string]string {
+	versions := make(map[string]string)
+	for _, line := range parseLines(out) {
+		if fields := strings.Fields(line); len(fields) > 1 {
+			versions[fields[0]] = fields[len(fields)-1]
+		}
+	}
+	return versions
+}
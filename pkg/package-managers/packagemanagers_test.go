@@ -1,9 +1,12 @@
 package packagemanagers
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -54,13 +57,162 @@ func TestHelperProcess(t *testing.T) {
 		return
 	}
 	// fmt.Println(os.Args[3:])
+	fmt.Print(os.Getenv("GO_HELPER_PROCESS_OUTPUT"))
 	os.Exit(0)
 }
 
+// mockExecOutput is written to stdout by the commands of mockExecCommand.
+var mockExecOutput string
+
+// mockExecCalls records the commands of mockExecCommand.
+var mockExecCalls [][]string
+
 func mockExecCommand(command string, args ...string) *exec.Cmd {
+	mockExecCalls = append(mockExecCalls, append([]string{command}, args...))
 	cs := []string{"-test.run=TestHelperProcess", "--", command}
 	cs = append(cs, args...)
 	cmd := exec.Command(os.Args[0], cs...)
-	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "GO_HELPER_PROCESS_OUTPUT=" + mockExecOutput}
 	return cmd
 }
+
+func TestListInstalled(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.Command; mockExecOutput = "" }()
+
+	cases := []struct {
+		PackageManager string
+		Output         string
+		Expected       []string
+	}{
+		{"brew", "git\nwget\n", []string{"git", "wget"}},
+		{"cask", "iterm2\n", []string{"iterm2"}},
+		{"pip", "requests==2.31.0\nblack==23.7.0\n", []string{"requests", "black"}},
+		{"npm", `{"dependencies": {"typescript": {"version": "5.1.6"}, "eslint": {"version": "8.45.0"}}}`, []string{"eslint", "typescript"}},
+		{"apt", "curl\ngit\n", []string{"curl", "git"}},
+		{"yum", "curl\n\ngit\n", []string{"curl", "git"}},
+		{"rubygems", "\n*** LOCAL GEMS ***\n\nbundler\nrake\n", []string{"bundler", "rake"}},
+		{"apm", "minimap@4.40.0\n", []string{"minimap"}},
+	}
+	for _, tc := range cases {
+		mockExecOutput = tc.Output
+		packages, err := GetPackageManager(tc.PackageManager).ListInstalled()
+		if err != nil {
+			t.Errorf("%s ListInstalled returned an error: %s", tc.PackageManager, err)
+			continue
+		}
+		if !reflect.DeepEqual(packages, tc.Expected) {
+			t.Errorf("%s ListInstalled returned wrong packages: got %#v want %#v",
+				tc.PackageManager, packages, tc.Expected)
+		}
+	}
+}
+
+func TestListUserInstalled(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.Command; mockExecOutput = "" }()
+
+	cases := []struct {
+		PackageManager string
+		Output         string
+		Expected       []string
+	}{
+		{"brew", "git\nwget\n", []string{"git", "wget"}},
+		{"pip", "black==23.7.0\n", []string{"black"}},
+		{"apt", "curl\ngit\n", []string{"curl", "git"}},
+		{"yum", "Packages installed by user\ngit-2.39.3-1.el8_8.x86_64\nperl-Git-2.39.3-1.el8_8.noarch\n", []string{"git", "perl-Git"}},
+	}
+	for _, tc := range cases {
+		mockExecOutput = tc.Output
+		packages, err := GetPackageManager(tc.PackageManager).ListUserInstalled()
+		if err != nil {
+			t.Errorf("%s ListUserInstalled returned an error: %s", tc.PackageManager, err)
+			continue
+		}
+		if !reflect.DeepEqual(packages, tc.Expected) {
+			t.Errorf("%s ListUserInstalled returned wrong packages: got %#v want %#v",
+				tc.PackageManager, packages, tc.Expected)
+		}
+	}
+}
+
+func TestInstalledVersions(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.Command; mockExecOutput = "" }()
+
+	cases := []struct {
+		PackageManager string
+		Output         string
+		Expected       map[string]string
+	}{
+		{"brew", "git 2.41.0\npython@3.11 3.11.4_1 3.11.5\n", map[string]string{"git": "2.41.0", "python@3.11": "3.11.5"}},
+		{"cask", "iterm2 3.4.19\n", map[string]string{"iterm2": "3.4.19"}},
+		{"pip", "requests==2.31.0\n", map[string]string{"requests": "2.31.0"}},
+		{"npm", `{"dependencies": {"typescript": {"version": "5.1.6"}}}`, map[string]string{"typescript": "5.1.6"}},
+		{"apt", "curl 7.88.1-10\n", map[string]string{"curl": "7.88.1-10"}},
+		{"yum", "git 2.39.3-1.el8_8\n", map[string]string{"git": "2.39.3-1.el8_8"}},
+		{"rubygems", "\n*** LOCAL GEMS ***\n\nbundler (2.4.17, default: 2.4.10)\nrake (default: 13.0.6)\n", map[string]string{"bundler": "2.4.17", "rake": "13.0.6"}},
+		{"apm", "minimap@4.40.0\n", map[string]string{"minimap": "4.40.0"}},
+	}
+	for _, tc := range cases {
+		mockExecOutput = tc.Output
+		versions, err := GetPackageManager(tc.PackageManager).InstalledVersions()
+		if err != nil {
+			t.Errorf("%s InstalledVersions returned an error: %s", tc.PackageManager, err)
+			continue
+		}
+		if !reflect.DeepEqual(versions, tc.Expected) {
+			t.Errorf("%s InstalledVersions returned wrong versions: got %#v want %#v",
+				tc.PackageManager, versions, tc.Expected)
+		}
+	}
+}
+
+func TestInstallMany(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.Command; mockExecCalls = nil }()
+
+	cases := []struct {
+		PackageManager string
+		Packages       []string
+		Expected       [][]string
+	}{
+		{"brew", []string{"git", "node@20"}, [][]string{{Brew.Path, "install", "git", "node@20"}}},
+		{"cask", []string{"iterm2", "dash"}, [][]string{{Cask.Path, "cask", "install", "iterm2", "dash"}}},
+		{"pip", []string{"requests>=2,<3", "black"}, [][]string{{Pip.Path, "install", "-U", "requests>=2,<3", "black"}}},
+		{"npm", []string{"typescript@5", "eslint"}, [][]string{{Npm.Path, "install", "-g", "typescript@5", "eslint"}}},
+		{"apt", []string{"curl", "git"}, [][]string{{Apt.Path, "install", "curl", "git"}}},
+		{"yum", []string{"curl", "git"}, [][]string{{Yum.Path, "install", "curl", "git"}}},
+		{"rubygems", []string{"rails@7.1", "rake", "bundler"}, [][]string{{RubyGems.Path, "install", "rails", "-v", "7.1"}, {RubyGems.Path, "install", "rake", "bundler"}}},
+		{"apm", []string{"minimap"}, [][]string{{Apm.Path, "install", "minimap"}}},
+		{"brew", nil, nil},
+	}
+	for _, tc := range cases {
+		mockExecCalls = nil
+		if err := GetPackageManager(tc.PackageManager).InstallMany(tc.Packages); err != nil {
+			t.Errorf("%s InstallMany returned an error: %s", tc.PackageManager, err)
+			continue
+		}
+		if !reflect.DeepEqual(mockExecCalls, tc.Expected) {
+			t.Errorf("%s InstallMany ran wrong commands: got %#v want %#v",
+				tc.PackageManager, mockExecCalls, tc.Expected)
+		}
+	}
+
+	if err := Brew.InstallMany([]string{"git", "node>=20"}); !errors.Is(err, ErrUnsupportedConstraint) {
+		t.Errorf("InstallMany returned wrong error: got %v want %v", err, ErrUnsupportedConstraint)
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	for name, packageManager := range SupportedPackageManagers {
+		for _, dependency := range packageManager.DependsOn() {
+			if !IsSupportedPackageManager(dependency) || dependency == name {
+				t.Errorf("%s DependsOn returned wrong package manager: %s", name, dependency)
+			}
+		}
+	}
+	if dependencies := Cask.DependsOn(); !reflect.DeepEqual(dependencies, []string{"brew"}) {
+		t.Errorf("cask DependsOn returned wrong package managers: got %#v want %#v", dependencies, []string{"brew"})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/thylong/ian/pkg/command"
 )
@@ -38,12 +39,49 @@ type PipPackageManager struct {
 
 // Install given Pip package.
 func (pip *PipPackageManager) Install(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(pip.Path, "install", "-U", packageName)); err != nil {
-		return fmt.Errorf("Cannot %s install %s: %s", pip.Name, packageName, err)
+	args, err := installArgs(pip, packageName)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(pip.Path, append([]string{"install", "-U"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", pip.Name, packageName, err)
+	}
+	return err
+}
+
+// InstallMany installs the given Pip packages in a single command.
+func (pip *PipPackageManager) InstallMany(packageNames []string) (err error) {
+	if len(packageNames) == 0 {
+		return nil
+	}
+	args, err := installManyArgs(pip, packageNames)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(pip.Path, append([]string{"install", "-U"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", pip.Name, strings.Join(packageNames, " "), err)
 	}
 	return err
 }
 
+// PackageArgs returns the install arguments of a Pip package, as a
+// requirement specifier (name==1.2, name>=2,<3).
+func (pip *PipPackageManager) PackageArgs(spec PackageSpec) ([]string, error) {
+	var constraints []string
+	for _, constraint := range spec.Constraints {
+		// The compatible release of gems (~>) is written ~= by pip, which
+		// requires at least two segments.
+		if constraint.Operator == "~>" || constraint.Operator == "~=" {
+			if !strings.Contains(constraint.Version, ".") {
+				return nil, &UnsupportedConstraintError{PackageManager: pip.Name, Spec: spec, Reason: "~= needs at least two version segments"}
+			}
+			constraint.Operator = "~="
+		}
+		constraints = append(constraints, constraint.String())
+	}
+	return []string{spec.Name + strings.Join(constraints, ",")}, nil
+}
+
 // Uninstall given Pip package.
 func (pip *PipPackageManager) Uninstall(packageName string) (err error) {
 	if err = command.ExecuteCommand(execCommand(pip.Path, "uninstall", "-U", packageName)); err != nil {
@@ -97,6 +135,12 @@ func (pip *PipPackageManager) IsOSPackageManager() bool {
 	return false
 }
 
+// ListsSystemPackages returns false, as Pip only lists the packages
+// installed on purpose.
+func (pip *PipPackageManager) ListsSystemPackages() bool {
+	return false
+}
+
 // GetExecPath return immutable path to Pip executable.
 func (pip *PipPackageManager) GetExecPath() string {
 	return pip.Path
@@ -123,3 +167,41 @@ func (pip *PipPackageManager) GetName() string {
 func (pip *PipPackageManager) Setup() (err error) {
 	return nil
 }
+
+// ListInstalled returns the installed Pip packages.
+func (pip *PipPackageManager) ListInstalled() (packages []string, err error) {
+	out, err := command.ExecuteCommandOutput(execCommand(pip.Path, "list", "--format=freeze"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", pip.Name, err)
+	}
+	for _, line := range parseLines(out) {
+		packages = append(packages, strings.SplitN(line, "==", 2)[0])
+	}
+	return packages, nil
+}
+
+// ListUserInstalled returns the Pip packages installed in the user site.
+func (pip *PipPackageManager) ListUserInstalled() (packages []string, err error) {
+	out, err := command.ExecuteCommandOutput(execCommand(pip.Path, "list", "--user", "--format=freeze"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", pip.Name, err)
+	}
+	for _, line := range parseLines(out) {
+		packages = append(packages, strings.SplitN(line, "==", 2)[0])
+	}
+	return packages, nil
+}
+
+// InstalledVersions returns the version of every installed Pip package.
+func (pip *PipPackageManager) InstalledVersions() (map[string]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(pip.Path, "list", "--format=freeze"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", pip.Name, err)
+	}
+	return parseVersions(out, "=="), nil
+}
+
+// DependsOn returns nothing, as Pip relies on the Python of the system.
+func (pip *PipPackageManager) DependsOn() []string {
+	return nil
+}
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/thylong/ian/pkg/command"
 )
@@ -29,6 +31,9 @@ var RubyGems = RubyGemsPackageManager{Path: filepath.Clean("/usr/local/bin/gem")
 // ErrRubyGemsMissingFeature is returned when triggering an unsupported feature.
 var ErrRubyGemsMissingFeature = errors.New("gems is not designed to support this feature")
 
+// gemVersionsRegexp matches the name and the versions of a gem in gem list.
+var gemVersionsRegexp = regexp.MustCompile(`^(\S+) \((.+)\)$`)
+
 // RubyGemsPackageManager is a (widely used) unofficial Mac OS package manager.
 // (more: https://pip.sh/)
 type RubyGemsPackageManager struct {
@@ -38,12 +43,62 @@ type RubyGemsPackageManager struct {
 
 // Install given RubyGems package.
 func (gem *RubyGemsPackageManager) Install(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(gem.Path, "install", packageName)); err != nil {
-		return fmt.Errorf("Cannot %s install %s: %s", gem.Name, packageName, err)
+	args, err := installArgs(gem, packageName)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(gem.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", gem.Name, packageName, err)
+	}
+	return err
+}
+
+// InstallMany installs the given gems in a single command. As -v applies
+// to every gem of a command, versioned gems are installed one by one.
+func (gem *RubyGemsPackageManager) InstallMany(packageNames []string) (err error) {
+	var args []string
+	for _, packageName := range packageNames {
+		spec, err := ParsePackageSpec(packageName)
+		if err != nil {
+			return err
+		}
+		if len(spec.Constraints) > 0 {
+			if err = gem.Install(packageName); err != nil {
+				return err
+			}
+			continue
+		}
+		args = append(args, spec.Name)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	if err = command.ExecuteCommand(execCommand(gem.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", gem.Name, strings.Join(args, " "), err)
 	}
 	return err
 }
 
+// PackageArgs returns the install arguments of a gem, its version
+// requirement being given with -v (name -v ">= 2, < 3").
+func (gem *RubyGemsPackageManager) PackageArgs(spec PackageSpec) ([]string, error) {
+	if version, ok := spec.ExactVersion(); ok {
+		return []string{spec.Name, "-v", version}, nil
+	}
+	if len(spec.Constraints) == 0 {
+		return []string{spec.Name}, nil
+	}
+	var constraints []string
+	for _, constraint := range spec.Constraints {
+		// The compatible release of pip (~=) is written ~> by gems.
+		if constraint.Operator == "~=" {
+			constraint.Operator = "~>"
+		}
+		constraints = append(constraints, constraint.Operator+" "+constraint.Version)
+	}
+	return []string{spec.Name, "-v", strings.Join(constraints, ", ")}, nil
+}
+
 // Uninstall given RubyGems package.
 func (gem *RubyGemsPackageManager) Uninstall(packageName string) (err error) {
 	if err = command.ExecuteCommand(execCommand(gem.Path, "uninstall", packageName)); err != nil {
@@ -98,6 +153,12 @@ func (gem *RubyGemsPackageManager) IsOSPackageManager() bool {
 	return false
 }
 
+// ListsSystemPackages returns false, as RubyGems only lists the packages
+// installed on purpose.
+func (gem *RubyGemsPackageManager) ListsSystemPackages() bool {
+	return false
+}
+
 // GetExecPath return immutable path to RubyGems executable.
 func (gem *RubyGemsPackageManager) GetExecPath() string {
 	return gem.Path
@@ -112,3 +173,46 @@ func (gem *RubyGemsPackageManager) GetName() string {
 func (gem *RubyGemsPackageManager) Setup() (err error) {
 	return nil
 }
+
+// ListInstalled returns the installed gems.
+func (gem *RubyGemsPackageManager) ListInstalled() (packages []string, err error) {
+	out, err := command.ExecuteCommandOutput(execCommand(gem.Path, "list", "--no-versions"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", gem.Name, err)
+	}
+	for _, line := range parseLines(out) {
+		if !strings.HasPrefix(line, "***") {
+			packages = append(packages, line)
+		}
+	}
+	return packages, nil
+}
+
+// ListUserInstalled returns the installed gems.
+func (gem *RubyGemsPackageManager) ListUserInstalled() ([]string, error) {
+	return gem.ListInstalled()
+}
+
+// InstalledVersions returns the latest installed version of every gem.
+func (gem *RubyGemsPackageManager) InstalledVersions() (map[string]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand(gem.Path, "list"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", gem.Name, err)
+	}
+	versions := make(map[string]string)
+	for _, line := range parseLines(out) {
+		// e.g. rake (13.0.6, default: 13.0.3), the latest version first.
+		match := gemVersionsRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		version := strings.TrimSpace(strings.Split(match[2], ",")[0])
+		versions[match[1]] = strings.TrimPrefix(version, "default: ")
+	}
+	return versions, nil
+}
+
+// DependsOn returns nothing, as RubyGems relies on the Ruby of the system.
+func (gem *RubyGemsPackageManager) DependsOn() []string {
+	return nil
+}
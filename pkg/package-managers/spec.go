@@ -0,0 +1,280 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packagemanagers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPackageSpec is returned when a package of env.yml can't be parsed.
+var ErrInvalidPackageSpec = errors.New("invalid package")
+
+// ErrUnsupportedConstraint is returned when a package manager can't install
+// a package with its version constraint.
+var ErrUnsupportedConstraint = errors.New("unsupported version constraint")
+
+// constraintOperators are the operators of a version constraint, the longest
+// first. A version without operator is an exact version. ~> (gems) and ~=
+// (pip) are compatible releases: ~>2.31 allows 2.31 and above, below 3.
+var constraintOperators = []string{"~>", "~=", "==", ">=", "<=", "!=", "=", ">", "<"}
+
+// versionRegexp matches a version, Debian epochs (1:2.39.2-1.1) and tildes
+// (1.2~rc1) included. npm ranges (^20, ~5.1) aren't versions.
+var versionRegexp = regexp.MustCompile(`^[A-Za-z0-9*][A-Za-z0-9._+*:~-]*$`)
+
+// Constraint restricts the versions of a package, e.g. >=2.
+type Constraint struct {
+	Operator string
+	Version  string
+}
+
+// String returns the constraint as written in env.yml.
+func (c Constraint) String() string {
+	if c.Operator == "=" {
+		return "==" + c.Version
+	}
+	return c.Operator + c.Version
+}
+
+// PackageSpec is a package of env.yml and the versions it may be installed with.
+type PackageSpec struct {
+	Name        string
+	Constraints []Constraint
+}
+
+// String returns the package as written in env.yml: name@version for an exact
+// version, otherwise the name followed by the constraints (name>=2,<3).
+func (spec PackageSpec) String() string {
+	if version, ok := spec.ExactVersion(); ok {
+		return spec.Name + "@" + version
+	}
+	var constraints []string
+	for _, constraint := range spec.Constraints {
+		constraints = append(constraints, constraint.String())
+	}
+	return spec.Name + strings.Join(constraints, ",")
+}
+
+// ExactVersion returns the version if the package is pinned to a single version.
+func (spec PackageSpec) ExactVersion() (string, bool) {
+	if len(spec.Constraints) == 1 && spec.Constraints[0].Operator == "=" {
+		return spec.Constraints[0].Version, true
+	}
+	return "", false
+}
+
+// ParsePackageSpec parses a package of env.yml: a name (node), a name and an
+// exact version (node@20) or a name and comma separated constraints
+// (node>=18,<21, rails~>7.1). Scoped npm packages (@angular/cli@16) are
+// supported.
+func ParsePackageSpec(entry string) (PackageSpec, error) {
+	entry = strings.TrimSpace(entry)
+	end := strings.IndexAny(strings.TrimPrefix(entry, "@"), "@=<>!~")
+	if end == -1 {
+		return NewPackageSpec(entry, "")
+	}
+	if strings.HasPrefix(entry, "@") {
+		end++
+	}
+	constraint := strings.TrimPrefix(entry[end:], "@")
+	if strings.TrimSpace(constraint) == "" {
+		return PackageSpec{}, fmt.Errorf("%w %q: missing version", ErrInvalidPackageSpec, entry)
+	}
+	return NewPackageSpec(entry[:end], constraint)
+}
+
+// NewPackageSpec returns the package spec of a name and a constraint, as
+// written in the mapping form of env.yml (name: node, version: ">=18,<21").
+func NewPackageSpec(name string, constraint string) (spec PackageSpec, err error) {
+	spec.Name = strings.TrimSpace(name)
+	if spec.Name == "" || strings.ContainsAny(spec.Name, " \t~") || (strings.HasPrefix(spec.Name, "@") && !strings.Contains(spec.Name, "/")) {
+		return spec, fmt.Errorf("%w %q: invalid name", ErrInvalidPackageSpec, name)
+	}
+	if strings.TrimSpace(constraint) == "" {
+		return spec, nil
+	}
+	for _, part := range strings.Split(constraint, ",") {
+		part = strings.TrimSpace(part)
+		c := Constraint{Operator: "="}
+		for _, operator := range constraintOperators {
+			if strings.HasPrefix(part, operator) {
+				if c.Operator = operator; operator == "==" {
+					c.Operator = "="
+				}
+				part = strings.TrimSpace(strings.TrimPrefix(part, operator))
+				break
+			}
+		}
+		if !versionRegexp.MatchString(part) {
+			return spec, fmt.Errorf("%w %q: invalid version constraint %q", ErrInvalidPackageSpec, spec.Name, constraint)
+		}
+		c.Version = part
+		spec.Constraints = append(spec.Constraints, c)
+	}
+	return spec, nil
+}
+
+// Satisfies returns true if version matches every constraint. An exact
+// version also matches the versions it prefixes (20 matches 20.5.1).
+func (spec PackageSpec) Satisfies(version string) bool {
+	for _, constraint := range spec.Constraints {
+		cmp := CompareVersions(version, constraint.Version)
+		var ok bool
+		switch constraint.Operator {
+		case "=":
+			ok = cmp == 0 || hasVersionPrefix(version, constraint.Version)
+		case "!=":
+			ok = cmp != 0
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "~>", "~=":
+			ok = cmp >= 0 && CompareVersions(version, compatibleUpperBound(constraint.Version)) < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compatibleUpperBound returns the first version a compatible release
+// constraint excludes: its last segment is dropped and the new last one
+// incremented (2.31 gives 3, 1.2.3 gives 1.3).
+func compatibleUpperBound(version string) string {
+	segments := strings.Split(version, ".")
+	if len(segments) > 1 {
+		segments = segments[:len(segments)-1]
+	}
+	last, err := strconv.Atoi(segments[len(segments)-1])
+	if err != nil {
+		return version
+	}
+	segments[len(segments)-1] = strconv.Itoa(last + 1)
+	return strings.Join(segments, ".")
+}
+
+// versionSeparators separate the segments of a version.
+const versionSeparators = ".-_+"
+
+// hasVersionPrefix returns true if the first segments of version are prefix.
+func hasVersionPrefix(version string, prefix string) bool {
+	return len(version) > len(prefix) && strings.HasPrefix(version, prefix) &&
+		strings.ContainsRune(versionSeparators, rune(version[len(prefix)]))
+}
+
+// CompareVersions compares two versions segment by segment, numerically when
+// both segments are numbers, missing segments counting as 0. Non-numeric
+// segments are prereleases, lower than a number or a missing segment
+// (2.0.0-rc1 < 2.0.0 < 2.0.0-1). It returns -1, 0 or 1.
+func CompareVersions(a string, b string) int {
+	isSeparator := func(r rune) bool { return strings.ContainsRune(versionSeparators, r) }
+	segmentsA, segmentsB := strings.FieldsFunc(a, isSeparator), strings.FieldsFunc(b, isSeparator)
+	for i := 0; i < len(segmentsA) || i < len(segmentsB); i++ {
+		segmentA, segmentB := "0", "0"
+		if i < len(segmentsA) {
+			segmentA = segmentsA[i]
+		}
+		if i < len(segmentsB) {
+			segmentB = segmentsB[i]
+		}
+		if segmentA == segmentB {
+			continue
+		}
+		numberA, errA := strconv.Atoi(segmentA)
+		numberB, errB := strconv.Atoi(segmentB)
+		switch {
+		case errA == nil && errB == nil:
+			if numberA == numberB {
+				continue
+			}
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		case errA != nil && errB == nil:
+			return -1
+		case errA == nil && errB != nil:
+			return 1
+		case segmentA < segmentB:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return 0
+}
+
+// UnsupportedConstraintError is returned when a package manager can't
+// install a package with its version constraint.
+type UnsupportedConstraintError struct {
+	PackageManager string
+	Spec           PackageSpec
+	Reason         string
+}
+
+func (e *UnsupportedConstraintError) Error() string {
+	return fmt.Sprintf("%s can't install %s: %s", e.PackageManager, e.Spec, e.Reason)
+}
+
+// Is makes UnsupportedConstraintError match ErrUnsupportedConstraint.
+func (e *UnsupportedConstraintError) Is(target error) bool {
+	return target == ErrUnsupportedConstraint
+}
+
+// exactVersionArgs returns the install arguments of package managers that
+// only support exact versions, joined to the name with separator.
+func exactVersionArgs(packageManager string, spec PackageSpec, separator string) ([]string, error) {
+	if len(spec.Constraints) == 0 {
+		return []string{spec.Name}, nil
+	}
+	version, ok := spec.ExactVersion()
+	if !ok {
+		return nil, &UnsupportedConstraintError{PackageManager: packageManager, Spec: spec, Reason: "only exact versions are supported"}
+	}
+	return []string{spec.Name + separator + version}, nil
+}
+
+// installArgs parses a package of env.yml into the install arguments of a
+// package manager.
+func installArgs(packageManager PackageManager, entry string) ([]string, error) {
+	spec, err := ParsePackageSpec(entry)
+	if err != nil {
+		return nil, err
+	}
+	return packageManager.PackageArgs(spec)
+}
+
+// installManyArgs parses packages of env.yml into the install arguments of a
+// package manager.
+func installManyArgs(packageManager PackageManager, entries []string) (args []string, err error) {
+	for _, entry := range entries {
+		packageArgs, err := installArgs(packageManager, entry)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, packageArgs...)
+	}
+	return args, nil
+}
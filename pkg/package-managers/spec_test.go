@@ -0,0 +1,143 @@
+package packagemanagers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePackageSpec(t *testing.T) {
+	cases := []struct {
+		Entry    string
+		Expected PackageSpec
+		String   string
+	}{
+		{"node", PackageSpec{Name: "node"}, "node"},
+		{"node@20", PackageSpec{Name: "node", Constraints: []Constraint{{"=", "20"}}}, "node@20"},
+		{"requests==2.31.0", PackageSpec{Name: "requests", Constraints: []Constraint{{"=", "2.31.0"}}}, "requests@2.31.0"},
+		{"node>=2,<3", PackageSpec{Name: "node", Constraints: []Constraint{{">=", "2"}, {"<", "3"}}}, "node>=2,<3"},
+		{"rails >= 7, != 7.0.1", PackageSpec{Name: "rails", Constraints: []Constraint{{">=", "7"}, {"!=", "7.0.1"}}}, "rails>=7,!=7.0.1"},
+		{"@angular/cli", PackageSpec{Name: "@angular/cli"}, "@angular/cli"},
+		{"@angular/cli@16", PackageSpec{Name: "@angular/cli", Constraints: []Constraint{{"=", "16"}}}, "@angular/cli@16"},
+		{"rails~>7.1", PackageSpec{Name: "rails", Constraints: []Constraint{{"~>", "7.1"}}}, "rails~>7.1"},
+		{"requests ~= 2.31", PackageSpec{Name: "requests", Constraints: []Constraint{{"~=", "2.31"}}}, "requests~=2.31"},
+		{"git@1:2.39.2-1.1", PackageSpec{Name: "git", Constraints: []Constraint{{"=", "1:2.39.2-1.1"}}}, "git@1:2.39.2-1.1"},
+		{"vim@2:9.0.1378-2", PackageSpec{Name: "vim", Constraints: []Constraint{{"=", "2:9.0.1378-2"}}}, "vim@2:9.0.1378-2"},
+		{"foo@1.2~rc1", PackageSpec{Name: "foo", Constraints: []Constraint{{"=", "1.2~rc1"}}}, "foo@1.2~rc1"},
+		{"vim>=2:9.0", PackageSpec{Name: "vim", Constraints: []Constraint{{">=", "2:9.0"}}}, "vim>=2:9.0"},
+	}
+	for _, tc := range cases {
+		spec, err := ParsePackageSpec(tc.Entry)
+		if err != nil {
+			t.Fatalf("ParsePackageSpec(%q) failed: %s", tc.Entry, err)
+		}
+		if !reflect.DeepEqual(spec, tc.Expected) {
+			t.Errorf("ParsePackageSpec(%q) returned wrong spec: got %#v want %#v", tc.Entry, spec, tc.Expected)
+		}
+		if spec.String() != tc.String {
+			t.Errorf("PackageSpec.String returned wrong string: got %v want %v", spec.String(), tc.String)
+		}
+	}
+
+	for _, entry := range []string{"", "@20", "node@", "node>=2,", "node@1 2", "rails~bar@7", "rails~7", "node@^20", "typescript@~5.1"} {
+		if _, err := ParsePackageSpec(entry); !errors.Is(err, ErrInvalidPackageSpec) {
+			t.Errorf("ParsePackageSpec(%q) returned wrong error: got %v want %v", entry, err, ErrInvalidPackageSpec)
+		}
+	}
+	if _, err := NewPackageSpec("rails~", ">7"); !errors.Is(err, ErrInvalidPackageSpec) {
+		t.Errorf("NewPackageSpec func accepted a name with ~: got %v want %v", err, ErrInvalidPackageSpec)
+	}
+}
+
+func TestPackageArgs(t *testing.T) {
+	cases := []struct {
+		PackageManager string
+		Entry          string
+		Expected       []string
+		ExpectedErr    error
+	}{
+		{"brew", "node", []string{"node"}, nil},
+		{"brew", "node@20", []string{"node@20"}, nil},
+		{"brew", "node>=20", nil, ErrUnsupportedConstraint},
+		{"cask", "iterm2@3", nil, ErrUnsupportedConstraint},
+		{"pip", "requests@1.2", []string{"requests==1.2"}, nil},
+		{"pip", "requests>=2,<3", []string{"requests>=2,<3"}, nil},
+		{"npm", "typescript@5", []string{"typescript@5"}, nil},
+		{"npm", "typescript>=4,<6", []string{"typescript@>=4 <6"}, nil},
+		{"npm", "typescript!=5", nil, ErrUnsupportedConstraint},
+		{"npm", "typescript~>5.1", []string{"typescript@>=5.1 <6"}, nil},
+		{"pip", "requests~=2.31", []string{"requests~=2.31"}, nil},
+		{"pip", "requests~>2.31", []string{"requests~=2.31"}, nil},
+		{"pip", "requests~=2", nil, ErrUnsupportedConstraint},
+		{"rubygems", "rails~>7", []string{"rails", "-v", "~> 7"}, nil},
+		{"rubygems", "rails~=7.1", []string{"rails", "-v", "~> 7.1"}, nil},
+		{"brew", "node~>20", nil, ErrUnsupportedConstraint},
+		{"rubygems", "rails@7.1", []string{"rails", "-v", "7.1"}, nil},
+		{"rubygems", "rails>=2,<3", []string{"rails", "-v", ">= 2, < 3"}, nil},
+		{"apt", "curl@7.88", []string{"curl=7.88"}, nil},
+		{"yum", "curl@7.88", []string{"curl-7.88"}, nil},
+		{"yum", "curl<8", nil, ErrUnsupportedConstraint},
+		{"apm", "minimap@4", []string{"minimap@4"}, nil},
+	}
+	for _, tc := range cases {
+		args, err := installArgs(GetPackageManager(tc.PackageManager), tc.Entry)
+		if !errors.Is(err, tc.ExpectedErr) {
+			t.Errorf("%s PackageArgs(%q) returned wrong error: got %v want %v", tc.PackageManager, tc.Entry, err, tc.ExpectedErr)
+		}
+		if !reflect.DeepEqual(args, tc.Expected) {
+			t.Errorf("%s PackageArgs(%q) returned wrong args: got %#v want %#v", tc.PackageManager, tc.Entry, args, tc.Expected)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	cases := []struct {
+		Entry    string
+		Version  string
+		Expected bool
+	}{
+		{"node", "20.5.1", true},
+		{"node@20", "20.5.1", true},
+		{"node@20", "201.0", false},
+		{"node@20.5", "20.6.0", false},
+		{"requests==2.31", "2.31.0", true},
+		{"requests>=2,<3", "2.31.0", true},
+		{"requests>=2,<3", "3.0", false},
+		{"requests>=2,<3", "1.9.9", false},
+		{"rails!=7.0.1", "7.0.1", false},
+		{"rails>7.0", "7.0.10", true},
+		{"curl@7.88.1", "7.88.1-10", true},
+		{"rails~>7.1", "7.4.2", true},
+		{"rails~>7.1", "8.0", false},
+		{"rails~>7.1", "7.0.8", false},
+		{"requests~=2.31.0", "2.31.4", true},
+		{"requests~=2.31.0", "2.32.0", false},
+	}
+	for _, tc := range cases {
+		spec, _ := ParsePackageSpec(tc.Entry)
+		if ok := spec.Satisfies(tc.Version); ok != tc.Expected {
+			t.Errorf("%s Satisfies(%q) returned %t, want %t", tc.Entry, tc.Version, ok, tc.Expected)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		A, B     string
+		Expected int
+	}{
+		{"1.2", "1.2.0", 0},
+		{"1.10", "1.9", 1},
+		{"2.0.0-rc1", "2.0.0-rc2", -1},
+		{"3", "20", -1},
+		{"2.0.0-rc1", "2.0.0", -1},
+		{"2.0.0", "2.0.0-beta", 1},
+		{"2.0.0-rc1", "2.0.0-1", -1},
+		{"1.02", "1.2", 0},
+	}
+	for _, tc := range cases {
+		if cmp := CompareVersions(tc.A, tc.B); cmp != tc.Expected {
+			t.Errorf("CompareVersions(%q, %q) returned %d, want %d", tc.A, tc.B, cmp, tc.Expected)
+		}
+	}
+}
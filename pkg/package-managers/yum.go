@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
 
 	"github.com/thylong/ian/pkg/command"
 )
@@ -35,12 +37,37 @@ type YumPackageManager struct {
 
 // Install given Yum package.
 func (yum *YumPackageManager) Install(packageName string) (err error) {
-	if err = command.ExecuteCommand(execCommand(yum.Path, "install", packageName)); err != nil {
-		return fmt.Errorf("Cannot %s install %s: %s", yum.Name, packageName, err)
+	args, err := installArgs(yum, packageName)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(yum.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", yum.Name, packageName, err)
+	}
+	return err
+}
+
+// InstallMany installs the given Yum packages in a single command.
+func (yum *YumPackageManager) InstallMany(packageNames []string) (err error) {
+	if len(packageNames) == 0 {
+		return nil
+	}
+	args, err := installManyArgs(yum, packageNames)
+	if err != nil {
+		return err
+	}
+	if err = command.ExecuteCommand(execCommand(yum.Path, append([]string{"install"}, args...)...)); err != nil {
+		return fmt.Errorf("Cannot %s install %s: %w", yum.Name, strings.Join(packageNames, " "), err)
 	}
 	return err
 }
 
+// PackageArgs returns the install arguments of a Yum package (name-version).
+// Only exact versions are supported.
+func (yum *YumPackageManager) PackageArgs(spec PackageSpec) ([]string, error) {
+	return exactVersionArgs(yum.Name, spec, "-")
+}
+
 // Uninstall given Yum package.
 func (yum *YumPackageManager) Uninstall(packageName string) (err error) {
 	if err = command.ExecuteCommand(execCommand(yum.Path, "erase", packageName)); err != nil {
@@ -103,6 +130,12 @@ func (yum *YumPackageManager) IsOSPackageManager() bool {
 	return yum.IsInstalled() && runtime.GOOS == "linux"
 }
 
+// ListsSystemPackages returns true, as the base system packages are marked as
+// installed on purpose by Yum.
+func (yum *YumPackageManager) ListsSystemPackages() bool {
+	return true
+}
+
 // GetExecPath return immutable path to Yum executable.
 func (yum *YumPackageManager) GetExecPath() string {
 	return yum.Path
@@ -117,3 +150,44 @@ func (yum *YumPackageManager) GetName() string {
 func (yum *YumPackageManager) Setup() (err error) {
 	return nil
 }
+
+// ListInstalled returns the installed Yum packages.
+func (yum *YumPackageManager) ListInstalled() ([]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand("rpm", "-qa", "--qf", "%{NAME}\n"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", yum.Name, err)
+	}
+	return parseLines(out), nil
+}
+
+// yumPackageRegexp matches the name of a package from its
+// name-version-release.arch form.
+var yumPackageRegexp = regexp.MustCompile(`^(\S+)-[^-\s]+-[^-\s]+$`)
+
+// ListUserInstalled returns the Yum packages installed by the user.
+func (yum *YumPackageManager) ListUserInstalled() (packages []string, err error) {
+	out, err := command.ExecuteCommandOutput(execCommand(yum.Path, "history", "userinstalled"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed packages: %s", yum.Name, err)
+	}
+	for _, line := range parseLines(out) {
+		if matches := yumPackageRegexp.FindStringSubmatch(line); matches != nil {
+			packages = append(packages, matches[1])
+		}
+	}
+	return packages, nil
+}
+
+// InstalledVersions returns the version-release of every installed Yum package.
+func (yum *YumPackageManager) InstalledVersions() (map[string]string, error) {
+	out, err := command.ExecuteCommandOutput(execCommand("rpm", "-qa", "--qf", "%{NAME} %{VERSION}-%{RELEASE}\n"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot %s list installed versions: %s", yum.Name, err)
+	}
+	return parseVersions(out, " "), nil
+}
+
+// DependsOn returns nothing, as Yum is an OS package manager.
+func (yum *YumPackageManager) DependsOn() []string {
+	return nil
+}
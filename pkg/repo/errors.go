@@ -0,0 +1,32 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import "errors"
+
+// ErrRepositoriesPathNotSet is returned when repositories_path is missing from config.yml
+var ErrRepositoriesPathNotSet = errors.New("repositories_path is not set in config.yml")
+
+// ErrInvalidRepository is returned when a repository name escapes repositories_path
+var ErrInvalidRepository = errors.New("Invalid repository name")
+
+// ErrRepositoryNotFound is returned when a repository doesn't exist in repositories_path
+var ErrRepositoryNotFound = errors.New("Repository not found in repositories_path")
+
+// ErrInvalidRemote is returned when a repository remote can't be parsed
+var ErrInvalidRemote = errors.New("Invalid repository remote")
+
+// ErrUnknownHost is returned when the host of a repository shorthand can't be determined
+var ErrUnknownHost = errors.New("Unknown host for provider, set dotfiles.host in config.yml")
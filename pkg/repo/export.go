@@ -0,0 +1,83 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"path/filepath"
+
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/log"
+)
+
+// Export adds the repositories found in repositories_path to the
+// repositories section of config.yml. Repositories already listed (matched by
+// path) get their remote and branch updated. Repositories without an origin
+// remote are skipped.
+func Export() (added []string, updated []string, err error) {
+	manifest, err := config.GetRepositoriesManifest()
+	if err != nil {
+		return nil, nil, err
+	}
+	if manifest == nil {
+		manifest = make(map[string]config.RepositoryConfig)
+	}
+	repositoriesPath, err := GetRepositoriesPath()
+	if err != nil {
+		return nil, nil, err
+	}
+	discovered, err := Discover()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	namesByPath := make(map[string]string)
+	for name, repository := range manifest {
+		namesByPath[filepath.Clean(repository.Path)] = name
+	}
+
+	for _, repositoryPath := range discovered {
+		fullPath := filepath.Join(repositoriesPath, repositoryPath)
+		remote, err := git(fullPath, "remote", "get-url", "origin")
+		if err != nil {
+			log.Warningf("Skipping %s: no origin remote\n", repositoryPath)
+			continue
+		}
+		branch, err := git(fullPath, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil || branch == "HEAD" {
+			// Detached HEAD or no commit yet: let clone use the remote HEAD.
+			branch = ""
+		}
+		repository := config.RepositoryConfig{Remote: remote, Path: filepath.ToSlash(repositoryPath), Branch: branch}
+
+		if name, ok := namesByPath[filepath.Clean(repositoryPath)]; ok {
+			if manifest[name] != repository {
+				manifest[name] = repository
+				updated = append(updated, name)
+			}
+			continue
+		}
+		name := filepath.Base(repositoryPath)
+		if _, ok := manifest[name]; ok {
+			name = repository.Path
+		}
+		manifest[name] = repository
+		added = append(added, name)
+	}
+
+	if len(added) == 0 && len(updated) == 0 {
+		return nil, nil, nil
+	}
+	return added, updated, config.SaveRepositoriesManifest(manifest)
+}
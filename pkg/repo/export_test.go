@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/thylong/ian/pkg/config"
+)
+
+func TestExport(t *testing.T) {
+	repositoriesPath := config.Vipers["config"].GetString("repositories_path")
+	configFilePath := config.ConfigFilesPathes["config"]
+	defer func() {
+		config.Vipers["config"].Set("repositories_path", repositoriesPath)
+		config.ConfigFilesPathes["config"] = configFilePath
+	}()
+
+	root := setupRepositories(t)
+	origin := filepath.Join(filepath.Dir(root), "origin.git")
+	config.Vipers["config"].Set("repositories_path", root)
+	config.ConfigFilesPathes["config"] = filepath.Join(t.TempDir(), "config.yml")
+
+	initial := `repositories_path: ` + root + `
+dotfiles:
+  repository: thylong/dotfiles
+repositories:
+  main:
+    remote: git@example.com:old.git
+    path: uptodate
+`
+	if err := os.WriteFile(config.ConfigFilesPathes["config"], []byte(initial), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	added, updated, err := Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(added)
+	if expected := []string{"conflict", "diverged"}; !reflect.DeepEqual(added, expected) {
+		t.Errorf("Export returned wrong added repositories: got %v want %v", added, expected)
+	}
+	if expected := []string{"main"}; !reflect.DeepEqual(updated, expected) {
+		t.Errorf("Export returned wrong updated repositories: got %v want %v", updated, expected)
+	}
+
+	manifest, err := config.GetRepositoriesManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := manifest["conflict"].Branch
+	expected := map[string]config.RepositoryConfig{
+		"main":     {Remote: origin, Path: "uptodate", Branch: branch},
+		"conflict": {Remote: origin, Path: "conflict", Branch: branch},
+		"diverged": {Remote: origin, Path: "diverged", Branch: branch},
+	}
+	if branch == "" || !reflect.DeepEqual(manifest, expected) {
+		t.Errorf("Export wrote wrong manifest: got %+v want %+v", manifest, expected)
+	}
+
+	content, _ := os.ReadFile(config.ConfigFilesPathes["config"])
+	if !strings.Contains(string(content), "repository: thylong/dotfiles") {
+		t.Errorf("Export didn't preserve other settings:\n%s", content)
+	}
+
+	if added, updated, err = Export(); err != nil || len(added) != 0 || len(updated) != 0 {
+		t.Errorf("Export should be idempotent: got %v %v %v", added, updated, err)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
+)
+
+// DefaultParallelism is the number of repositories processed concurrently
+// when neither a flag nor repositories_parallelism is set.
+const DefaultParallelism = 8
+
+// State describes the outcome of an operation on a repository.
+type State string
+
+const (
+	// StateOK means the operation completed successfully.
+	StateOK State = "ok"
+	// StateCloned means a missing repository has been cloned.
+	StateCloned State = "cloned"
+	// StateConflict means a rebase stopped on conflicts (and was aborted).
+	StateConflict State = "conflict"
+	// StateDiverged means local and upstream branches both have new commits.
+	StateDiverged State = "diverged"
+	// StateNotAGitRepository means the directory isn't a git repository.
+	StateNotAGitRepository State = "not-a-git-repo"
+	// StateFailed means the operation failed for any other reason.
+	StateFailed State = "failed"
+)
+
+// Result is the outcome of an operation on a single repository.
+type Result struct {
+	Repository string
+	State      State
+	Err        error
+}
+
+// Failed returns true if the operation didn't complete on the repository.
+func (result Result) Failed() bool {
+	return result.State == StateConflict || result.State == StateFailed
+}
+
+// HasFailures returns true if at least one of the results failed.
+func HasFailures(results []Result) bool {
+	for _, result := range results {
+		if result.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetParallelism returns the given parallelism if positive, otherwise
+// repositories_parallelism from config.yml, otherwise DefaultParallelism.
+func GetParallelism(parallelism int) int {
+	if parallelism > 0 {
+		return parallelism
+	}
+	if parallelism = config.Vipers["config"].GetInt("repositories_parallelism"); parallelism > 0 {
+		return parallelism
+	}
+	return DefaultParallelism
+}
+
+// UpdateAll fetches every repository in repositories_path concurrently.
+func UpdateAll(parallelism int) ([]Result, error) {
+	return forEachRepository(parallelism, fetchRepository)
+}
+
+// UpgradeAll pulls (with rebase) every repository in repositories_path concurrently.
+func UpgradeAll(parallelism int) ([]Result, error) {
+	return forEachRepository(parallelism, pullRepository)
+}
+
+// forEachRepository runs fn over every directory of repositories_path using
+// a pool of at most parallelism workers. Results are sorted by repository.
+func forEachRepository(parallelism int, fn func(repositoryPath string) Result) ([]Result, error) {
+	repositoriesPath, repositories, err := listRepositoriesDirs()
+	if err != nil {
+		return nil, err
+	}
+	return runParallel(repositories, GetParallelism(parallelism), func(repository string) Result {
+		result := fn(filepath.Join(repositoriesPath, repository))
+		result.Repository = repository
+		return result
+	}), nil
+}
+
+// listRepositoriesDirs returns repositories_path and the sorted names of the
+// directories it contains.
+func listRepositoriesDirs() (string, []string, error) {
+	repositoriesPath, err := GetRepositoriesPath()
+	if err != nil {
+		return "", nil, err
+	}
+	files, err := ioutil.ReadDir(repositoriesPath)
+	if err != nil {
+		return "", nil, err
+	}
+	var repositories []string
+	for _, file := range files {
+		if file.IsDir() {
+			repositories = append(repositories, file.Name())
+		}
+	}
+	return repositoriesPath, repositories, nil
+}
+
+// runParallel runs fn over repositories using a pool of at most parallelism
+// workers. Outputs are returned in the same order as repositories.
+func runParallel[T any](repositories []string, parallelism int, fn func(repository string) T) []T {
+	outputs := make([]T, len(repositories))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				outputs[index] = fn(repositories[index])
+			}
+		}()
+	}
+	for index := range repositories {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	return outputs
+}
+
+// PrintResults writes results as an aligned table followed by a summary.
+func PrintResults(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tSTATE\tDETAILS")
+
+	counts := make(map[State]int)
+	for _, result := range results {
+		details := ""
+		if result.Err != nil {
+			details = result.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Repository, result.State, details)
+		counts[result.State]++
+	}
+	tw.Flush()
+
+	var summary []string
+	for _, state := range []State{StateOK, StateCloned, StateConflict, StateDiverged, StateNotAGitRepository, StateFailed} {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[state], state))
+		}
+	}
+	fmt.Fprintf(w, "\n%d repositories: %s\n", len(results), strings.Join(summary, ", "))
+}
+
+// isGitRepository returns true if repositoryPath is the root of a git repository.
+func isGitRepository(repositoryPath string) bool {
+	_, err := os.Stat(filepath.Join(repositoryPath, ".git"))
+	return err == nil
+}
+
+// git runs a git command in dir and returns its trimmed combined output.
+// On failure, the returned error contains the last line of output.
+func git(dir string, args ...string) (string, error) {
+	termCmd := execCommand("git", args...)
+	termCmd.Dir = dir
+	out, err := termCmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		lines := strings.Split(output, "\n")
+		if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+			return output, fmt.Errorf("git %s: %s", args[0], last)
+		}
+		return output, fmt.Errorf("git %s: %s", args[0], err)
+	}
+	return output, nil
+}
+
+// gitChange is git for the commands changing a repository, recorded instead
+// of run in dry run.
+func gitChange(dir string, args ...string) (string, error) {
+	if dryrun.Record("git", "%s (in %s)", strings.Join(args, " "), dir) {
+		return "", nil
+	}
+	return git(dir, args...)
+}
+
+// getAheadBehind returns how many commits HEAD is ahead and behind its upstream.
+func getAheadBehind(repositoryPath string) (ahead int, behind int, err error) {
+	out, err := git(repositoryPath, "rev-list", "--left-right", "--count", "HEAD...@{upstream}")
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %q", out)
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	if behind, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, err
+	}
+	return ahead, behind, nil
+}
+
+// fetchRepository fetches a repository and reports if it diverged from upstream.
+func fetchRepository(repositoryPath string) Result {
+	if !isGitRepository(repositoryPath) {
+		return Result{State: StateNotAGitRepository}
+	}
+	if _, err := gitChange(repositoryPath, "fetch", "--quiet"); err != nil {
+		return Result{State: StateFailed, Err: err}
+	}
+	// Branches without upstream can't diverge.
+	if ahead, behind, err := getAheadBehind(repositoryPath); err == nil && ahead > 0 && behind > 0 {
+		return Result{State: StateDiverged, Err: fmt.Errorf("%d ahead, %d behind", ahead, behind)}
+	}
+	return Result{State: StateOK}
+}
+
+// pullRepository pulls a repository with rebase. A rebase stopping on
+// conflicts is aborted so the repository is left as it was.
+func pullRepository(repositoryPath string) Result {
+	if !isGitRepository(repositoryPath) {
+		return Result{State: StateNotAGitRepository}
+	}
+	out, err := gitChange(repositoryPath, "pull", "--rebase", "--quiet")
+	if err == nil {
+		return Result{State: StateOK}
+	}
+	if strings.Contains(out, "CONFLICT") {
+		gitChange(repositoryPath, "rebase", "--abort")
+		return Result{State: StateConflict, Err: err}
+	}
+	return Result{State: StateFailed, Err: err}
+}
@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/thylong/ian/pkg/config"
+)
+
+// runGit runs a git command in dir and fails the test on error.
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-c", "user.name=ian", "-c", "user.email=ian@example.com"}, args...)
+	termCmd := exec.Command("git", args...)
+	termCmd.Dir = dir
+	if out, err := termCmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %s: %s", args, err, out)
+	}
+}
+
+// commitFile writes content to name in dir and commits it.
+func commitFile(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "-q", "-m", "update "+name)
+}
+
+// setupRepositories creates repositories_path with repositories in every State.
+func setupRepositories(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	origin := filepath.Join(root, "origin.git")
+	repositoriesPath := filepath.Join(root, "repositories")
+	runGit(t, root, "init", "-q", "--bare", origin)
+
+	seed := filepath.Join(root, "seed")
+	runGit(t, root, "clone", "-q", origin, seed)
+	commitFile(t, seed, "README", "base\n")
+	runGit(t, seed, "push", "-q", "origin", "HEAD")
+
+	for _, name := range []string{"uptodate", "conflict", "diverged"} {
+		repositoryPath := filepath.Join(repositoriesPath, name)
+		runGit(t, root, "clone", "-q", origin, repositoryPath)
+		runGit(t, repositoryPath, "config", "user.name", "ian")
+		runGit(t, repositoryPath, "config", "user.email", "ian@example.com")
+	}
+	commitFile(t, filepath.Join(repositoriesPath, "conflict"), "README", "local\n")
+	commitFile(t, filepath.Join(repositoriesPath, "diverged"), "LOCAL", "local\n")
+
+	commitFile(t, seed, "README", "remote\n")
+	runGit(t, seed, "push", "-q", "origin", "HEAD")
+
+	if err := os.Mkdir(filepath.Join(repositoriesPath, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return repositoriesPath
+}
+
+func TestUpdateAll(t *testing.T) {
+	repositoriesPath := config.Vipers["config"].GetString("repositories_path")
+	defer config.Vipers["config"].Set("repositories_path", repositoriesPath)
+	config.Vipers["config"].Set("repositories_path", setupRepositories(t))
+
+	results, err := UpdateAll(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]State{
+		"conflict": StateDiverged,
+		"diverged": StateDiverged,
+		"notes":    StateNotAGitRepository,
+		"uptodate": StateOK,
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("UpdateAll returned wrong number of results: got %d want %d", len(results), len(expected))
+	}
+	for _, result := range results {
+		if result.State != expected[result.Repository] {
+			t.Errorf("UpdateAll returned wrong state for %s: got %v want %v (%v)",
+				result.Repository, result.State, expected[result.Repository], result.Err)
+		}
+	}
+	if HasFailures(results) {
+		t.Errorf("UpdateAll should not report failures")
+	}
+}
+
+func TestUpgradeAll(t *testing.T) {
+	repositoriesPath := config.Vipers["config"].GetString("repositories_path")
+	defer config.Vipers["config"].Set("repositories_path", repositoriesPath)
+	config.Vipers["config"].Set("repositories_path", setupRepositories(t))
+
+	results, err := UpgradeAll(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]State{
+		"conflict": StateConflict,
+		"diverged": StateOK,
+		"notes":    StateNotAGitRepository,
+		"uptodate": StateOK,
+	}
+	for _, result := range results {
+		if result.State != expected[result.Repository] {
+			t.Errorf("UpgradeAll returned wrong state for %s: got %v want %v (%v)",
+				result.Repository, result.State, expected[result.Repository], result.Err)
+		}
+	}
+	if !HasFailures(results) {
+		t.Errorf("UpgradeAll should report the conflict as a failure")
+	}
+}
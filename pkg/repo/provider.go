@@ -0,0 +1,146 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/thylong/ian/pkg/config"
+)
+
+// Provider is a git hosting service.
+type Provider struct {
+	Name string
+	// Host is the default host of the provider (empty for self-hosted only providers).
+	Host string
+}
+
+// Providers contains all the currently supported git hosting services.
+// Any other provider name is accepted as long as a host is given.
+var Providers = map[string]Provider{
+	"github":    {Name: "github", Host: "github.com"},
+	"gitlab":    {Name: "gitlab", Host: "gitlab.com"},
+	"bitbucket": {Name: "bitbucket", Host: "bitbucket.org"},
+	"gitea":     {Name: "gitea"},
+}
+
+// Remote is a repository hosted on a git server.
+type Remote struct {
+	Host string
+	// Port is the SSH port when not the default one.
+	Port string
+	// Path is the repository path without .git suffix (owner/repo, group/subgroup/repo, etc).
+	Path string
+}
+
+// SSHURL returns the SSH clone URL of the remote.
+func (remote Remote) SSHURL() string {
+	if remote.Port != "" {
+		return fmt.Sprintf("ssh://git@%s:%s/%s.git", remote.Host, remote.Port, remote.Path)
+	}
+	return fmt.Sprintf("git@%s:%s.git", remote.Host, remote.Path)
+}
+
+// HTTPSURL returns the HTTPS clone URL of the remote.
+func (remote Remote) HTTPSURL() string {
+	return fmt.Sprintf("https://%s/%s.git", remote.Host, remote.Path)
+}
+
+// ParseRemote returns the Remote described by repository, which can be:
+//   - a owner/repo shorthand, hosted on host or on the default host of provider
+//   - a full URL (https://host/owner/repo.git, ssh://git@host:port/owner/repo.git)
+//   - a SCP-like address (git@host:owner/repo.git or host:owner/repo)
+//   - a host/owner/repo path
+func ParseRemote(repository string, provider string, host string) (remote Remote, err error) {
+	repository = strings.TrimSpace(repository)
+
+	switch {
+	case filepath.IsAbs(repository) || strings.HasPrefix(repository, "."):
+		// Local repositories aren't hosted by a provider.
+		return remote, fmt.Errorf("%w: %s", ErrInvalidRemote, repository)
+	case strings.Contains(repository, "://"):
+		u, err := url.Parse(repository)
+		if err != nil || u.Hostname() == "" {
+			return remote, fmt.Errorf("%w: %s", ErrInvalidRemote, repository)
+		}
+		remote.Host = u.Hostname()
+		if u.Scheme == "ssh" {
+			remote.Port = u.Port()
+		}
+		remote.Path = u.Path
+	case strings.Contains(repository, ":"):
+		parts := strings.SplitN(repository, ":", 2)
+		remote.Host = parts[0][strings.LastIndex(parts[0], "@")+1:]
+		remote.Path = parts[1]
+	default:
+		segments := strings.Split(strings.Trim(repository, "/"), "/")
+		if len(segments) > 2 && strings.Contains(segments[0], ".") {
+			remote.Host = segments[0]
+			remote.Path = strings.Join(segments[1:], "/")
+		} else {
+			remote.Path = repository
+		}
+	}
+
+	remote.Path = strings.TrimSuffix(strings.Trim(remote.Path, "/"), ".git")
+	if len(strings.Split(remote.Path, "/")) < 2 || strings.Contains(remote.Path, "//") {
+		return Remote{}, fmt.Errorf("%w: %s", ErrInvalidRemote, repository)
+	}
+
+	if remote.Host == "" {
+		remote.Host = host
+	}
+	if remote.Host == "" {
+		remote.Host = Providers[strings.ToLower(provider)].Host
+	}
+	if remote.Host == "" {
+		return Remote{}, fmt.Errorf("%w: %s", ErrUnknownHost, provider)
+	}
+	return remote, nil
+}
+
+// GetGitRepositorySSHPath returns for a given repository path the full SSH path.
+// Shorthands are resolved using the dotfiles provider and host from config.yml.
+// Repositories that can't be parsed are returned unchanged.
+func GetGitRepositorySSHPath(repository string) string {
+	remote, err := ParseRemote(repository, config.GetDotfilesProvider(), config.GetDotfilesHost())
+	if err != nil {
+		return repository
+	}
+	return remote.SSHURL()
+}
+
+// GetGitRepositoryHTTPSPath returns for a given repository path the full HTTPS path.
+// Shorthands are resolved using the dotfiles provider and host from config.yml.
+// Repositories that can't be parsed are returned unchanged.
+func GetGitRepositoryHTTPSPath(repository string) string {
+	remote, err := ParseRemote(repository, config.GetDotfilesProvider(), config.GetDotfilesHost())
+	if err != nil {
+		return repository
+	}
+	return remote.HTTPSURL()
+}
+
+// ResolveRemote returns the SSH URL of shorthand repositories (owner/repo,
+// host/owner/repo). URLs, SCP-like addresses and local paths are returned unchanged.
+func ResolveRemote(repository string) string {
+	if strings.Contains(repository, ":") {
+		return repository
+	}
+	return GetGitRepositorySSHPath(repository)
+}
@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	cases := []struct {
+		Repository  string
+		Provider    string
+		Host        string
+		ExpectedSSH string
+		ExpectedURL string
+		ExpectedErr error
+	}{
+		// Shorthands
+		{"thylong/dotfiles", "github", "", "git@github.com:thylong/dotfiles.git", "https://github.com/thylong/dotfiles.git", nil},
+		{"thylong/dotfiles.git", "github", "", "git@github.com:thylong/dotfiles.git", "https://github.com/thylong/dotfiles.git", nil},
+		{"thylong/dotfiles", "gitlab", "", "git@gitlab.com:thylong/dotfiles.git", "https://gitlab.com/thylong/dotfiles.git", nil},
+		{"group/subgroup/dotfiles", "gitlab", "", "git@gitlab.com:group/subgroup/dotfiles.git", "https://gitlab.com/group/subgroup/dotfiles.git", nil},
+		{"thylong/dotfiles", "bitbucket", "", "git@bitbucket.org:thylong/dotfiles.git", "https://bitbucket.org/thylong/dotfiles.git", nil},
+		{"thylong/dotfiles", "BitBucket", "", "git@bitbucket.org:thylong/dotfiles.git", "https://bitbucket.org/thylong/dotfiles.git", nil},
+		{"thylong/dotfiles", "gitea", "gitea.example.com", "git@gitea.example.com:thylong/dotfiles.git", "https://gitea.example.com/thylong/dotfiles.git", nil},
+		{"thylong/dotfiles", "gitlab", "gitlab.example.com", "git@gitlab.example.com:thylong/dotfiles.git", "https://gitlab.example.com/thylong/dotfiles.git", nil},
+		{"thylong/dotfiles", "mycorp", "git.mycorp.com", "git@git.mycorp.com:thylong/dotfiles.git", "https://git.mycorp.com/thylong/dotfiles.git", nil},
+		{"thylong/dotfiles", "gitea", "", "", "", ErrUnknownHost},
+		{"thylong/dotfiles", "mycorp", "", "", "", ErrUnknownHost},
+		{"git.mycorp.com/thylong/dotfiles", "github", "", "git@git.mycorp.com:thylong/dotfiles.git", "https://git.mycorp.com/thylong/dotfiles.git", nil},
+		// Full URLs
+		{"https://github.com/thylong/dotfiles", "github", "", "git@github.com:thylong/dotfiles.git", "https://github.com/thylong/dotfiles.git", nil},
+		{"https://gitlab.example.com/group/dotfiles.git", "github", "", "git@gitlab.example.com:group/dotfiles.git", "https://gitlab.example.com/group/dotfiles.git", nil},
+		{"ssh://git@gitea.example.com:2222/thylong/dotfiles.git", "gitea", "", "ssh://git@gitea.example.com:2222/thylong/dotfiles.git", "https://gitea.example.com/thylong/dotfiles.git", nil},
+		{"ssh://git@bitbucket.org/thylong/dotfiles.git", "github", "", "git@bitbucket.org:thylong/dotfiles.git", "https://bitbucket.org/thylong/dotfiles.git", nil},
+		// SCP-like addresses
+		{"git@github.com:thylong/dotfiles.git", "gitlab", "", "git@github.com:thylong/dotfiles.git", "https://github.com/thylong/dotfiles.git", nil},
+		{"gitlab.example.com:group/dotfiles", "gitlab", "", "git@gitlab.example.com:group/dotfiles.git", "https://gitlab.example.com/group/dotfiles.git", nil},
+		// Invalid repositories
+		{"dotfiles", "github", "", "", "", ErrInvalidRemote},
+		{"", "github", "", "", "", ErrInvalidRemote},
+		{"thylong//dotfiles", "github", "", "", "", ErrInvalidRemote},
+		{"https://github.com/dotfiles", "github", "", "", "", ErrInvalidRemote},
+		{"/srv/git/dotfiles.git", "github", "", "", "", ErrInvalidRemote},
+		{"./dotfiles", "github", "", "", "", ErrInvalidRemote},
+	}
+	for _, tc := range cases {
+		remote, err := ParseRemote(tc.Repository, tc.Provider, tc.Host)
+		if !errors.Is(err, tc.ExpectedErr) {
+			t.Errorf("ParseRemote(%q, %q, %q) returned wrong err: got %#v want %#v",
+				tc.Repository, tc.Provider, tc.Host, err, tc.ExpectedErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if url := remote.SSHURL(); url != tc.ExpectedSSH {
+			t.Errorf("ParseRemote(%q, %q, %q) returned wrong SSH URL: got %v want %v",
+				tc.Repository, tc.Provider, tc.Host, url, tc.ExpectedSSH)
+		}
+		if url := remote.HTTPSURL(); url != tc.ExpectedURL {
+			t.Errorf("ParseRemote(%q, %q, %q) returned wrong HTTPS URL: got %v want %v",
+				tc.Repository, tc.Provider, tc.Host, url, tc.ExpectedURL)
+		}
+	}
+}
+
+func TestResolveRemote(t *testing.T) {
+	cases := []struct {
+		Repository string
+		Expected   string
+	}{
+		{"https://github.com/thylong/ian.git", "https://github.com/thylong/ian.git"},
+		{"git@gitlab.com:thylong/ian.git", "git@gitlab.com:thylong/ian.git"},
+		{"/srv/git/ian.git", "/srv/git/ian.git"},
+		{"git.mycorp.com/thylong/ian", "git@git.mycorp.com:thylong/ian.git"},
+	}
+	for _, tc := range cases {
+		if remote := ResolveRemote(tc.Repository); remote != tc.Expected {
+			t.Errorf("ResolveRemote(%q) returned wrong remote: got %v want %v",
+				tc.Repository, remote, tc.Expected)
+		}
+	}
+}
@@ -15,113 +15,133 @@
 package repo
 
 import (
-	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/thylong/ian/pkg/command"
 	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
 	"github.com/thylong/ian/pkg/log"
 )
 
 var execCommand = exec.Command
 
+// GetRepositoriesPath returns the configured repositories_path.
+func GetRepositoriesPath() (string, error) {
+	repositoriesPath := strings.TrimSpace(config.Vipers["config"].GetString("repositories_path"))
+	if repositoriesPath == "" {
+		return "", ErrRepositoriesPathNotSet
+	}
+	return repositoriesPath, nil
+}
+
+// GetRepositoryPath returns the full path of a repository located in
+// repositories_path. Names escaping repositories_path are rejected.
+func GetRepositoryPath(repository string) (string, error) {
+	repositoriesPath, err := GetRepositoriesPath()
+	if err != nil {
+		return "", err
+	}
+	repository = filepath.Clean(strings.TrimSpace(repository))
+	if repository == "." || filepath.IsAbs(repository) ||
+		repository == ".." || strings.HasPrefix(repository, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidRepository
+	}
+	return filepath.Join(repositoriesPath, repository), nil
+}
+
+// getExistingRepositoryPath returns the full path of a repository and ensures it exists.
+func getExistingRepositoryPath(repository string) (string, error) {
+	repositoryPath, err := GetRepositoryPath(repository)
+	if err != nil {
+		return "", err
+	}
+	if fileInfo, err := os.Stat(repositoryPath); err != nil || !fileInfo.IsDir() {
+		return "", ErrRepositoryNotFound
+	}
+	return repositoryPath, nil
+}
+
 // List local repositories
 func List() error {
+	repositoriesPath, err := GetRepositoriesPath()
+	if err != nil {
+		return err
+	}
 	termCmd := execCommand("ls")
-	log.Infof("repositories_path: %s\n", config.Vipers["config"].GetString("repositories_path"))
-	termCmd.Dir = config.Vipers["config"].GetString("repositories_path")
+	log.Infof("repositories_path: %s\n", repositoriesPath)
+	termCmd.Dir = repositoriesPath
 
 	return command.ExecuteCommand(termCmd)
 }
 
 // Clone local repository
 func Clone(repository string) error {
-	termCmd := execCommand("git", "clone", "-v", repository)
-	termCmd.Dir = config.Vipers["config"].GetString("repositories_path")
+	repositoriesPath, err := GetRepositoriesPath()
+	if err != nil {
+		return err
+	}
+	termCmd := execCommand("git", "clone", "-v", ResolveRemote(repository))
+	termCmd.Dir = repositoriesPath
 
-	command.ExecuteInteractiveCommand(termCmd)
-	return nil
+	return command.ExecuteInteractiveCommand(termCmd)
 }
 
 // Clean given repository
 func Clean(repository string) error {
-	termCmd := execCommand("git", "clean", "-dffx", repository)
-	termCmd.Dir = config.Vipers["config"].GetString("repositories_path")
-
-	return command.ExecuteCommand(termCmd)
-}
-
-// UpdateAll local repositories
-func UpdateAll() {
-	files, err := ioutil.ReadDir(config.Vipers["config"].GetString("repositories_path"))
+	repositoryPath, err := getExistingRepositoryPath(repository)
 	if err != nil {
-		log.Errorln(err)
-		os.Exit(1)
-	}
-	for _, file := range files {
-		if file.IsDir() {
-			UpdateOne(file.Name())
-		}
+		return err
 	}
-}
-
-// UpdateOne local repository
-func UpdateOne(repository string) error {
-	termCmd := execCommand("git", "fetch", repository)
-	termCmd.Dir = config.Vipers["config"].GetString("repositories_path")
+	termCmd := execCommand("git", "clean", "-dffx")
+	termCmd.Dir = repositoryPath
 
 	return command.ExecuteCommand(termCmd)
 }
 
-// UpgradeAll local repositories
-func UpgradeAll() {
-	files, err := ioutil.ReadDir(config.Vipers["config"].GetString("repositories_path"))
+// UpdateOne local repository
+func UpdateOne(repository string) error {
+	repositoryPath, err := getExistingRepositoryPath(repository)
 	if err != nil {
-		log.Errorln(err)
-		os.Exit(1)
-	}
-	for _, file := range files {
-		if file.IsDir() {
-			UpgradeOne(file.Name())
-		}
+		return err
 	}
+	termCmd := execCommand("git", "fetch")
+	termCmd.Dir = repositoryPath
+
+	return command.ExecuteCommand(termCmd)
 }
 
 // UpgradeOne local repository
 func UpgradeOne(repository string) error {
-	termCmd := execCommand("git", "pull", "--rebase", repository)
-	termCmd.Dir = config.Vipers["config"].GetString("repositories_path")
+	repositoryPath, err := getExistingRepositoryPath(repository)
+	if err != nil {
+		return err
+	}
+	termCmd := execCommand("git", "pull", "--rebase")
+	termCmd.Dir = repositoryPath
 
 	return command.ExecuteCommand(termCmd)
 }
 
 // Remove local repository
 func Remove(repository string) error {
-	if repository == "/*" || repository == "/" {
-		log.Errorln("Cmon, don't do that...")
+	repositoryPath, err := getExistingRepositoryPath(repository)
+	if err != nil {
+		return err
 	}
-	termCmd := execCommand("rm", "-rf", repository)
-	termCmd.Dir = config.Vipers["config"].GetString("repositories_path")
-
-	return command.MustExecuteCommand(termCmd)
+	return dryrun.RemoveAll(repositoryPath)
 }
 
 // Status local repository
 func Status(repository string) error {
+	repositoryPath, err := getExistingRepositoryPath(repository)
+	if err != nil {
+		return err
+	}
 	termCmd := execCommand("git", "status")
-	termCmd.Dir = config.Vipers["config"].GetString("repositories_path") + "/" + repository
+	termCmd.Dir = repositoryPath
 
 	return command.ExecuteCommand(termCmd)
 }
-
-// GetGitRepositorySSHPath returns for a given repository path the full SSH path.
-func GetGitRepositorySSHPath(repository string) string {
-	repository = strings.TrimPrefix(strings.TrimSuffix(repository, ".git"), "https://github.com/")
-	if !strings.HasPrefix(repository, "git@github.com:") {
-		repository = fmt.Sprintf("git@github.com:%s.git", repository)
-	}
-	return repository
-}
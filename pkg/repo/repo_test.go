@@ -0,0 +1,43 @@
+package repo
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/thylong/ian/pkg/config"
+)
+
+func TestGetRepositoryPath(t *testing.T) {
+	repositoriesPath := config.Vipers["config"].GetString("repositories_path")
+	defer config.Vipers["config"].Set("repositories_path", repositoriesPath)
+
+	cases := []struct {
+		RepositoriesPath string
+		Repository       string
+		ExpectedPath     string
+		ExpectedErr      error
+	}{
+		{"/repositories", "ian", filepath.Join("/repositories", "ian"), nil},
+		{"/repositories\n", "thylong/ian", filepath.Join("/repositories", "thylong", "ian"), nil},
+		{"/repositories", "ian/../dotfiles", filepath.Join("/repositories", "dotfiles"), nil},
+		{"/repositories", "../ian", "", ErrInvalidRepository},
+		{"/repositories", "..", "", ErrInvalidRepository},
+		{"/repositories", "/", "", ErrInvalidRepository},
+		{"/repositories", "/etc", "", ErrInvalidRepository},
+		{"/repositories", "", "", ErrInvalidRepository},
+		{"", "ian", "", ErrRepositoriesPathNotSet},
+	}
+	for _, tc := range cases {
+		config.Vipers["config"].Set("repositories_path", tc.RepositoriesPath)
+
+		path, err := GetRepositoryPath(tc.Repository)
+		if err != tc.ExpectedErr {
+			t.Errorf("GetRepositoryPath(%q) returned wrong err: got %#v want %#v",
+				tc.Repository, err, tc.ExpectedErr)
+		}
+		if path != tc.ExpectedPath {
+			t.Errorf("GetRepositoryPath(%q) returned wrong path: got %v want %v",
+				tc.Repository, path, tc.ExpectedPath)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RepositoryStatus is a snapshot of the state of a local repository.
+type RepositoryStatus struct {
+	Repository      string    `json:"repository"`
+	IsGitRepository bool      `json:"is_git_repository"`
+	Branch          string    `json:"branch,omitempty"`
+	Upstream        string    `json:"upstream,omitempty"`
+	Ahead           int       `json:"ahead"`
+	Behind          int       `json:"behind"`
+	Staged          int       `json:"staged"`
+	Modified        int       `json:"modified"`
+	Untracked       int       `json:"untracked"`
+	Conflicted      int       `json:"conflicted"`
+	Stashes         int       `json:"stashes"`
+	LastCommit      time.Time `json:"last_commit"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// IsDirty returns true if the repository has uncommitted changes.
+func (status RepositoryStatus) IsDirty() bool {
+	return status.Staged+status.Modified+status.Untracked+status.Conflicted > 0
+}
+
+// HasLocalWork returns true if the repository contains work that only exists
+// on this machine (uncommitted changes, unpushed commits or stashes).
+func (status RepositoryStatus) HasLocalWork() bool {
+	return status.IsDirty() || status.Ahead > 0 || status.Stashes > 0
+}
+
+// StatusAll returns the status of every repository in repositories_path.
+func StatusAll(parallelism int) ([]RepositoryStatus, error) {
+	repositoriesPath, repositories, err := listRepositoriesDirs()
+	if err != nil {
+		return nil, err
+	}
+	return runParallel(repositories, GetParallelism(parallelism), func(repository string) RepositoryStatus {
+		status := GetRepositoryStatus(filepath.Join(repositoriesPath, repository))
+		status.Repository = repository
+		return status
+	}), nil
+}
+
+// GetRepositoryStatus returns the status of the repository located at repositoryPath.
+func GetRepositoryStatus(repositoryPath string) (status RepositoryStatus) {
+	status.Repository = filepath.Base(repositoryPath)
+	if !isGitRepository(repositoryPath) {
+		return status
+	}
+	status.IsGitRepository = true
+
+	out, err := git(repositoryPath, "status", "--porcelain=v2", "--branch")
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	parseStatusPorcelain(out, &status)
+
+	if out, err = git(repositoryPath, "stash", "list"); err == nil && out != "" {
+		status.Stashes = len(strings.Split(out, "\n"))
+	}
+	// Repositories without commits have no last commit.
+	if out, err = git(repositoryPath, "log", "-1", "--format=%ct"); err == nil {
+		if timestamp, err := strconv.ParseInt(out, 10, 64); err == nil {
+			status.LastCommit = time.Unix(timestamp, 0)
+		}
+	}
+	return status
+}
+
+// parseStatusPorcelain fills status from the output of
+// git status --porcelain=v2 --branch.
+func parseStatusPorcelain(out string, status *RepositoryStatus) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "#":
+			switch {
+			case fields[1] == "branch.head" && len(fields) > 2:
+				status.Branch = fields[2]
+			case fields[1] == "branch.upstream" && len(fields) > 2:
+				status.Upstream = fields[2]
+			case fields[1] == "branch.ab" && len(fields) > 3:
+				status.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+				status.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+			}
+		case "1", "2":
+			if fields[1][0] != '.' {
+				status.Staged++
+			}
+			if len(fields[1]) > 1 && fields[1][1] != '.' {
+				status.Modified++
+			}
+		case "u":
+			status.Conflicted++
+		case "?":
+			status.Untracked++
+		}
+	}
+}
+
+// PrintStatuses writes statuses as an aligned table followed by a summary.
+func PrintStatuses(w io.Writer, statuses []RepositoryStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tBRANCH\tAHEAD\tBEHIND\tSTAGED\tMODIFIED\tUNTRACKED\tCONFLICTED\tSTASHES\tLAST COMMIT")
+
+	var withLocalWork int
+	for _, status := range statuses {
+		if !status.IsGitRepository {
+			fmt.Fprintf(tw, "%s\t%s\t\t\t\t\t\t\t\t\n", status.Repository, StateNotAGitRepository)
+			continue
+		}
+		if status.Error != "" {
+			fmt.Fprintf(tw, "%s\t%s\t\t\t\t\t\t\t\t\n", status.Repository, status.Error)
+			continue
+		}
+		if status.HasLocalWork() {
+			withLocalWork++
+		}
+		upstream := func(count int) string {
+			if status.Upstream == "" {
+				return "-"
+			}
+			return strconv.Itoa(count)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			status.Repository, status.Branch, upstream(status.Ahead), upstream(status.Behind),
+			status.Staged, status.Modified, status.Untracked, status.Conflicted,
+			status.Stashes, formatAge(status.LastCommit, time.Now()))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d repositories, %d with uncommitted changes, unpushed commits or stashes\n",
+		len(statuses), withLocalWork)
+}
+
+// PrintStatusesJSON writes statuses as indented JSON.
+func PrintStatusesJSON(w io.Writer, statuses []RepositoryStatus) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+// formatAge returns a short human readable duration between t and now.
+func formatAge(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	age := now.Sub(t)
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	case age < 30*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	case age < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", int(age.Hours()/24/30))
+	}
+	return fmt.Sprintf("%dy ago", int(age.Hours()/24/365))
+}
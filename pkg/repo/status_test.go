@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStatusPorcelain(t *testing.T) {
+	cases := []struct {
+		Output   string
+		Expected RepositoryStatus
+	}{
+		{
+			"# branch.oid (initial)\n# branch.head master",
+			RepositoryStatus{Branch: "master"},
+		},
+		{
+			`# branch.oid 2c3d1e
+# branch.head feature
+# branch.upstream origin/feature
+# branch.ab +2 -3
+1 M. N... 100644 100644 100644 a b staged.go
+1 .M N... 100644 100644 100644 a b modified.go
+1 MM N... 100644 100644 100644 a b both.go
+2 R. N... 100644 100644 100644 a b R100 new.go	old.go
+u UU N... 100644 100644 100644 100644 a b c conflict.go
+? untracked.go
+? other.go
+! ignored.go`,
+			RepositoryStatus{
+				Branch: "feature", Upstream: "origin/feature", Ahead: 2, Behind: 3,
+				Staged: 3, Modified: 2, Untracked: 2, Conflicted: 1,
+			},
+		},
+		{
+			"# branch.oid 2c3d1e\n# branch.head (detached)",
+			RepositoryStatus{Branch: "(detached)"},
+		},
+	}
+	for _, tc := range cases {
+		var status RepositoryStatus
+		parseStatusPorcelain(tc.Output, &status)
+		if status != tc.Expected {
+			t.Errorf("parseStatusPorcelain returned wrong status: got %+v want %+v",
+				status, tc.Expected)
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		Time     time.Time
+		Expected string
+	}{
+		{time.Time{}, "-"},
+		{now.Add(-5 * time.Minute), "5m ago"},
+		{now.Add(-3 * time.Hour), "3h ago"},
+		{now.Add(-4 * 24 * time.Hour), "4d ago"},
+		{now.Add(-65 * 24 * time.Hour), "2mo ago"},
+		{now.Add(-800 * 24 * time.Hour), "2y ago"},
+	}
+	for _, tc := range cases {
+		if age := formatAge(tc.Time, now); age != tc.Expected {
+			t.Errorf("formatAge returned wrong age: got %v want %v", age, tc.Expected)
+		}
+	}
+}
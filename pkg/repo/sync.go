@@ -0,0 +1,149 @@
+// Copyright 2023 Théotime Levêque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
+)
+
+// discoverMaxDepth is the maximum depth, relative to repositories_path,
+// at which repositories are looked up.
+const discoverMaxDepth = 3
+
+// Sync converges repositories_path to the repositories manifest: missing
+// repositories are cloned and existing ones are fetched. It also returns the
+// repositories found in repositories_path that aren't part of the manifest.
+func Sync(parallelism int) (results []Result, extras []string, err error) {
+	manifest, err := config.GetRepositoriesManifest()
+	if err != nil {
+		return nil, nil, err
+	}
+	repositoriesPath, err := GetRepositoriesPath()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := dryrun.MkdirAll(repositoriesPath, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	for name := range manifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results = runParallel(names, GetParallelism(parallelism), func(name string) Result {
+		result := syncRepository(manifest[name])
+		result.Repository = name
+		return result
+	})
+
+	discovered, err := Discover()
+	if err != nil {
+		return results, nil, err
+	}
+	declared := make(map[string]bool)
+	for _, repository := range manifest {
+		declared[filepath.Clean(repository.Path)] = true
+	}
+	for _, repository := range discovered {
+		if !declared[repository] {
+			extras = append(extras, repository)
+		}
+	}
+	return results, extras, nil
+}
+
+// syncRepository clones a repository of the manifest if missing, otherwise fetches it.
+func syncRepository(repository config.RepositoryConfig) Result {
+	repositoryPath, err := GetRepositoryPath(repository.Path)
+	if err != nil {
+		return Result{State: StateFailed, Err: err}
+	}
+	if _, err := os.Stat(repositoryPath); err == nil {
+		return fetchRepository(repositoryPath)
+	}
+
+	if err := dryrun.MkdirAll(filepath.Dir(repositoryPath), 0755); err != nil {
+		return Result{State: StateFailed, Err: err}
+	}
+	args := []string{"clone", "--quiet"}
+	if repository.Branch != "" {
+		args = append(args, "--branch", repository.Branch)
+	}
+	args = append(args, ResolveRemote(repository.Remote), repositoryPath)
+	if _, err := gitChange(filepath.Dir(repositoryPath), args...); err != nil {
+		return Result{State: StateFailed, Err: err}
+	}
+	return Result{State: StateCloned}
+}
+
+// Discover returns the sorted paths, relative to repositories_path, of the git
+// repositories it contains. Repositories nested into other ones are ignored.
+func Discover() ([]string, error) {
+	repositoriesPath, err := GetRepositoriesPath()
+	if err != nil {
+		return nil, err
+	}
+	var repositories []string
+	var walk func(relativePath string, depth int) error
+	walk = func(relativePath string, depth int) error {
+		files, err := ioutil.ReadDir(filepath.Join(repositoriesPath, relativePath))
+		// repositories_path isn't created in dry run.
+		if relativePath == "" && os.IsNotExist(err) && dryrun.Enabled() {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if !file.IsDir() {
+				continue
+			}
+			repository := filepath.Join(relativePath, file.Name())
+			if isGitRepository(filepath.Join(repositoriesPath, repository)) {
+				repositories = append(repositories, repository)
+			} else if depth < discoverMaxDepth {
+				if err := walk(repository, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk("", 1); err != nil {
+		return nil, err
+	}
+	return repositories, nil
+}
+
+// PrintExtras writes the repositories that aren't part of the manifest.
+func PrintExtras(w io.Writer, extras []string) {
+	if len(extras) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%d repositories are not in the repositories manifest:\n", len(extras))
+	for _, repository := range extras {
+		fmt.Fprintf(w, "  %s\n", repository)
+	}
+}
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thylong/ian/pkg/config"
+	"github.com/thylong/ian/pkg/dryrun"
+)
+
+func TestSync(t *testing.T) {
+	repositoriesPath := config.Vipers["config"].GetString("repositories_path")
+	configFilePath := config.ConfigFilesPathes["config"]
+	defer func() {
+		config.Vipers["config"].Set("repositories_path", repositoriesPath)
+		config.ConfigFilesPathes["config"] = configFilePath
+	}()
+
+	root := setupRepositories(t)
+	origin := filepath.Join(filepath.Dir(root), "origin.git")
+	config.Vipers["config"].Set("repositories_path", root)
+	config.ConfigFilesPathes["config"] = filepath.Join(t.TempDir(), "config.yml")
+
+	manifest := fmt.Sprintf(`repositories:
+  uptodate:
+    remote: %[1]s
+  nested:
+    remote: %[1]s
+    path: team/nested
+  shorthand: %[1]s
+  broken:
+    remote: %[2]s
+`, origin, filepath.Join(root, "missing.git"))
+	if err := os.WriteFile(config.ConfigFilesPathes["config"], []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, extras, err := Sync(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]State{
+		"broken":    StateFailed,
+		"nested":    StateCloned,
+		"shorthand": StateCloned,
+		"uptodate":  StateOK,
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Sync returned wrong number of results: got %d want %d", len(results), len(expected))
+	}
+	for _, result := range results {
+		if result.State != expected[result.Repository] {
+			t.Errorf("Sync returned wrong state for %s: got %v want %v (%v)",
+				result.Repository, result.State, expected[result.Repository], result.Err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "team", "nested", ".git")); err != nil {
+		t.Errorf("Sync didn't clone nested repository: %v", err)
+	}
+	if expectedExtras := []string{"conflict", "diverged"}; !reflect.DeepEqual(extras, expectedExtras) {
+		t.Errorf("Sync returned wrong extras: got %v want %v", extras, expectedExtras)
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	repositoriesPath := config.Vipers["config"].GetString("repositories_path")
+	configFilePath := config.ConfigFilesPathes["config"]
+	defer func() {
+		config.Vipers["config"].Set("repositories_path", repositoriesPath)
+		config.ConfigFilesPathes["config"] = configFilePath
+	}()
+
+	// Restoring the repositories in dry run doesn't spawn any process.
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		t.Errorf("Sync ran %s %v in dry run", name, args)
+		return exec.Command("false")
+	}
+	defer func() { execCommand = exec.Command }()
+	dryrun.Enable(nil)
+	defer dryrun.Disable()
+
+	root := filepath.Join(t.TempDir(), "repositories")
+	config.Vipers["config"].Set("repositories_path", root)
+	config.ConfigFilesPathes["config"] = filepath.Join(t.TempDir(), "config.yml")
+	manifest := "repositories:\n  ian:\n    remote: https://github.com/thylong/ian.git\n    path: team/ian\n"
+	if err := os.WriteFile(config.ConfigFilesPathes["config"], []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, _, err := Sync(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []Result{{Repository: "ian", State: StateCloned}}; !reflect.DeepEqual(results, expected) {
+		t.Errorf("Sync returned wrong results: got %#v want %#v", results, expected)
+	}
+	expected := []dryrun.Operation{
+		{Kind: "mkdir", Description: root},
+		{Kind: "mkdir", Description: filepath.Join(root, "team")},
+		{Kind: "git", Description: "clone --quiet https://github.com/thylong/ian.git " + filepath.Join(root, "team", "ian") + " (in " + filepath.Join(root, "team") + ")"},
+	}
+	if operations := dryrun.Operations(); !reflect.DeepEqual(operations, expected) {
+		t.Errorf("Sync recorded wrong operations: got %#v want %#v", operations, expected)
+	}
+	if _, err := os.Stat(root); err == nil {
+		t.Errorf("Sync created %s in dry run", root)
+	}
+}
+
+func TestDiscoverMissingRepositoriesPath(t *testing.T) {
+	repositoriesPath := config.Vipers["config"].GetString("repositories_path")
+	defer config.Vipers["config"].Set("repositories_path", repositoriesPath)
+	config.Vipers["config"].Set("repositories_path", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := Discover(); !os.IsNotExist(err) {
+		t.Errorf("Discover returned wrong error: got %v want a not exist error", err)
+	}
+
+	dryrun.Enable(nil)
+	defer dryrun.Disable()
+	if repositories, err := Discover(); err != nil || repositories != nil {
+		t.Errorf("Discover returned repositories in dry run: got (%v, %v) want none", repositories, err)
+	}
+}